@@ -5,14 +5,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"math" // Added for math.Sqrt
 	"net/http"
-	"os"
 	"path/filepath"
-	"sort" // Added for sort.Slice
 	"strings"
 	"sync"         // Added for mutex
 	"time"         // Added for timing
@@ -23,43 +21,96 @@ import (
 )
 
 const (
-	ollamaApiUrl          = "http://localhost:11434/api" // Base URL for Ollama API
-	chatModelName         = "llama3"                     // Model for chat completions
-	embeddingModelName    = "nomic-embed-text"           // Model for generating embeddings
-	ragRelevanceThreshold = 0.5                          // Minimum relevance score to use RAG context
-	defaultChunkSizeChars = 1000                         // Target chunk size in characters for recursive splitting
-	defaultOverlapChars   = 100                          // Overlap in characters for recursive splitting
+	defaultChunkSizeChars = 1000 // Target chunk size in characters for recursive splitting
+	defaultOverlapChars   = 100  // Overlap in characters for recursive splitting
 )
 
 // DocumentChunk defines the structure for a piece of text from a document.
 type DocumentChunk struct {
-	ID         int       `json:"id"`
-	Text       string    `json:"text"`
-	Embedding  []float64 `json:"embedding"`   // Stores the vector embedding of the text
-	SourceFile string    `json:"source_file"` // Original file this chunk came from
-	Score      float64   // Added Score field for ranking
+	ID         int           `json:"id"`
+	Text       string        `json:"text"`
+	Embedding  []float32     `json:"embedding"`      // Unit-length embedding of the text, so cosine similarity is a dot product
+	SourceFile string        `json:"source_file"`    // Original file this chunk came from
+	Page       int           `json:"page,omitempty"` // 1-based page the chunk came from; 0 for formats without pages
+	Metadata   ChunkMetadata `json:"metadata"`       // Patient, document type, date and tags of the source file, for filtering
+	Score      float64       `json:"-"`              // Added Score field for ranking; not persisted
+	// VectorScore and KeywordScore are the parts of Score from embedding similarity and
+	// BM25 in hybrid retrieval; not persisted.
+	VectorScore  float64 `json:"-"`
+	KeywordScore float64 `json:"-"`
+	RerankScore  float64 `json:"-"` // Relevance rated by the re-ranking model, 0 to 1; not persisted
+	Reranked     bool    `json:"-"` // RerankScore is set
 }
 
 // SourceInfo defines the structure for information about a retrieved document chunk.
 type SourceInfo struct {
 	FileName string  `json:"fileName"`
+	Page     int     `json:"page,omitempty"` // 1-based page for paginated documents such as PDFs
 	ChunkID  int     `json:"chunkId"`
 	Score    float64 `json:"score"`
+	// VectorScore and KeywordScore are the embedding and keyword parts of Score in
+	// hybrid retrieval.
+	VectorScore  float64  `json:"vectorScore,omitempty"`
+	KeywordScore float64  `json:"keywordScore,omitempty"`
+	RerankScore  *float64 `json:"rerankScore,omitempty"` // Relevance rated by the re-ranking model, 0 to 1; nil when not re-ranked
+	Sent         bool     `json:"sent"`                  // The chunk was part of the prompt
+	SkipReason   string   `json:"skipReason,omitempty"`  // Why a retrieved chunk was not sent
+}
+
+// RagSourcesEvent is the payload of ragSourcesEvent, sent before an answer is streamed.
+type RagSourcesEvent struct {
+	RequestID      string       `json:"requestId"`      // HandleMessage call the sources belong to
+	ConversationID string       `json:"conversationId"` // Conversation the answer is added to
+	Sources        []SourceInfo `json:"sources"`
+}
+
+// sourceLabel returns a human-readable reference to where a chunk came from,
+// e.g. "report.pdf p.3".
+func sourceLabel(chunk DocumentChunk) string {
+	if chunk.Page > 0 {
+		return fmt.Sprintf("%s p.%d", chunk.SourceFile, chunk.Page)
+	}
+	return chunk.SourceFile
 }
 
 // App struct
 type App struct {
-	ctx            context.Context
-	documentStore  []DocumentChunk
-	nextDocumentID int
-	mu             sync.Mutex // Mutex to protect documentStore and nextDocumentID
+	ctx          context.Context
+	store        *VectorStore                  // Persistent store of document chunks and embeddings
+	settings     Settings                      // User configuration; see settings.go
+	settingsPath string                        // Location of the settings file; empty keeps changes in memory only
+	loadCancel   context.CancelFunc            // Cancels the running document load; nil when idle
+	pulls        map[string]context.CancelFunc // Cancels running model pulls, keyed by model name
+	mu           sync.Mutex                    // Mutex to protect settings, settingsPath, settingsVersion, loadCancel and pulls
+
+	settingsVersion uint64     // Incremented by every settings change
+	savedVersion    uint64     // Settings version last written to the settings file
+	saveMu          sync.Mutex // Mutex to serialise writes of the settings file and protect savedVersion
+
+	conversations map[string]*Conversation // Chat histories keyed by conversation ID
+	sessionsDir   string                   // Directory of saved sessions; empty keeps chats in memory only
+	convMu        sync.Mutex               // Mutex to protect conversations and sessionsDir
+
+	generations map[string]*generation // Running and queued answers, keyed by request ID
+	genMu       sync.Mutex             // Mutex to protect generations
+	limiter     *generationLimiter     // Bounds the number of answers generated at once
+
+	backendStatus BackendStatus // Result of the latest health check
+	healthRecheck chan struct{} // Wakes the health monitor for an immediate check
+	healthMu      sync.Mutex    // Mutex to protect backendStatus
 }
 
 // NewApp creates a new App application struct
 func NewApp() *App {
 	return &App{
-		documentStore:  make([]DocumentChunk, 0), // Initialize documentStore
-		nextDocumentID: 1,                        // Initialize nextDocumentID
+		store:         newMemoryVectorStore(), // Replaced by the persisted store in startup
+		settings:      defaultSettings(),      // Replaced by the saved settings in startup
+		pulls:         make(map[string]context.CancelFunc),
+		conversations: make(map[string]*Conversation),
+		generations:   make(map[string]*generation),
+		limiter:       newGenerationLimiter(defaultMaxConcurrentGenerations),
+		backendStatus: BackendStatus{State: backendUnknown},
+		healthRecheck: make(chan struct{}, 1),
 		// mu will be zero-valued, which is ready for use
 	}
 }
@@ -77,6 +128,48 @@ func (a *App) startup(ctx context.Context) {
 	} else {
 		log.Println("COM initialized successfully for the main application thread.")
 	}
+
+	// Start monitoring Ollama once settings are loaded, however startup ends, so a missing
+	// server or model is reported up front instead of failing on the first question.
+	defer func() {
+		go a.runHealthMonitor()
+	}()
+
+	// Reload previously indexed documents so they don't need to be re-embedded.
+	dataDir, err := appDataDir()
+	if err != nil {
+		log.Printf("Error locating app data directory: %v. Documents will only be kept in memory.", err)
+		return
+	}
+	settingsPath := filepath.Join(dataDir, settingsFileName)
+	settings, err := loadSettings(settingsPath)
+	if err != nil {
+		log.Printf("Error loading settings: %v. Using default settings.", err)
+	}
+	a.mu.Lock()
+	a.settings = settings
+	a.settingsPath = settingsPath
+	a.mu.Unlock()
+	a.limiter.setLimit(settings.Chat.MaxConcurrentGenerations)
+
+	// Saved chat sessions are loaded independently of the vector store.
+	a.loadSessions(filepath.Join(dataDir, sessionsDirName))
+
+	store, err := openVectorStore(filepath.Join(dataDir, vectorStoreFileName))
+	if err != nil {
+		log.Printf("Error opening vector store: %v. Documents will only be kept in memory.", err)
+		a.store.ConfigureIndex(settings.VectorIndex)
+		return
+	}
+	if store.EmbeddingModel() == "" {
+		// Stores written before the model was recorded were built with the configured one.
+		store.SetEmbeddingModel(settings.EmbeddingModel)
+	}
+	store.ConfigureIndex(settings.VectorIndex)
+	a.store = store
+	if a.indexStale() {
+		log.Println(a.indexStatus().Message)
+	}
 }
 
 // shutdown is called when the app is shutting down.
@@ -97,9 +190,11 @@ type OllamaChatMessage struct { // Ensure this type is used consistently, or ren
 
 // OllamaChatRequest defines the structure for the Ollama API chat request
 type OllamaChatRequest struct {
-	Model    string              `json:"model"`
-	Messages []OllamaChatMessage `json:"messages"` // Uses the locally defined OllamaChatMessage
-	Stream   bool                `json:"stream"`
+	Model     string              `json:"model"`
+	Messages  []OllamaChatMessage `json:"messages"` // Uses the locally defined OllamaChatMessage
+	Stream    bool                `json:"stream"`
+	Options   *ollamaOptions      `json:"options,omitempty"`    // Sampling options; nil keeps the model's defaults
+	KeepAlive interface{}         `json:"keep_alive,omitempty"` // How long the model stays loaded; see GenerationOptions.ollamaKeepAlive
 }
 
 // OllamaChatResponse defines the structure for each chunk in the Ollama API stream
@@ -113,11 +208,15 @@ type OllamaChatResponse struct { // Ensure this type is used consistently
 
 // OllamaStreamEvent is the payload sent to the frontend for each stream event
 type OllamaStreamEvent struct {
+	RequestID      string  `json:"requestId"`        // HandleMessage call the event belongs to
+	ConversationID string  `json:"conversationId"`   // Conversation the answer is added to
+	Queued         bool    `json:"queued,omitempty"` // Sent once if the request waits for a free generation slot
 	Content        string  `json:"content,omitempty"`
 	Done           bool    `json:"done"`
 	Error          string  `json:"error,omitempty"`
 	DurationMs     int64   `json:"durationMs,omitempty"`     // Total duration for the response in milliseconds
 	RunesPerSecond float64 `json:"runesPerSecond,omitempty"` // Processed runes per second
+	Cancelled      bool    `json:"cancelled,omitempty"`      // Set on the final event when StopGeneration aborted the answer
 }
 
 // OllamaEmbeddingRequest defines the structure for the Ollama API embedding request
@@ -137,7 +236,7 @@ func (a *App) getOllamaEmbedding(text string) ([]float64, error) {
 	log.Printf("Requesting embedding for text (first 100 chars): %s...", text[:min(len(text), 100)])
 
 	requestBody := OllamaEmbeddingRequest{
-		Model:  embeddingModelName, // Uses the package-level constant
+		Model:  a.currentSettings().EmbeddingModel,
 		Prompt: text,
 	}
 
@@ -147,7 +246,7 @@ func (a *App) getOllamaEmbedding(text string) ([]float64, error) {
 		return nil, fmt.Errorf("could not process embedding request (marshal): %w", err)
 	}
 
-	apiEndpoint := ollamaApiUrl + "/embeddings" // Uses the package-level constant
+	apiEndpoint := a.ollamaURL("embeddings")
 	log.Printf("Sending embedding request to Ollama endpoint: %s. Payload: %s", apiEndpoint, string(jsonBody))
 
 	resp, err := http.Post(apiEndpoint, "application/json", bytes.NewBuffer(jsonBody))
@@ -358,10 +457,19 @@ func chunkTextRecursive(text string, chunkSizeChars int, overlapChars int) []str
 }
 
 // LoadPersonalData is a Wails-bindable method that prompts the user to select a directory,
-// then processes .txt files from that directory, chunks them, generates embeddings, and stores them in memory.
-func (a *App) LoadPersonalData() string {
+// then starts a background job that incrementally indexes the files under that directory
+// (recursively, filtered by the load settings) into the vector store.
+// It returns as soon as the job is started; progress and the final LoadSummary are
+// reported through "dataLoadEvent" events, and CancelLoad stops the job.
+func (a *App) LoadPersonalData() (string, error) {
+	// a.mu also guards the settings, so it is not held while the dialog is open:
+	// chats and the health monitor would wait for the user to pick a folder.
 	a.mu.Lock()
-	defer a.mu.Unlock()
+	loading := a.loadCancel != nil
+	a.mu.Unlock()
+	if loading {
+		return "", fmt.Errorf("a document load is already in progress")
+	}
 
 	log.Println("LoadPersonalData called. Prompting user to select a directory.")
 	dialogOptions := runtime.OpenDialogOptions{
@@ -377,119 +485,59 @@ func (a *App) LoadPersonalData() string {
 		if err.Error() == "shellItem is nil" {
 			statusMsg := "Document loading cancelled by user (dialog closed)."
 			log.Println(statusMsg)
-			return statusMsg // Return a user-friendly message
+			return statusMsg, nil // Return a user-friendly message
 		}
 		// For other errors, report them
 		errMsg := fmt.Sprintf("error opening directory dialog: %v", err)
 		log.Println(errMsg)
-		return errMsg
+		return "", fmt.Errorf("%s", errMsg)
 	}
 
 	if directoryPath == "" {
 		// This case handles cancellation where err is nil but path is empty (e.g., user presses the "Cancel" button if available, or selects nothing and clicks "OK")
 		statusMsg := "Document loading cancelled by user (no directory selected)."
 		log.Println(statusMsg)
-		return statusMsg
+		return statusMsg, nil
 	}
 
-	log.Printf("User selected directory: %s. Starting to load personal data.", directoryPath)
-
-	// Clear existing document store and reset ID under lock
-	a.documentStore = make([]DocumentChunk, 0)
-	a.nextDocumentID = 1
-	filesProcessed := 0
-	chunksLoaded := 0
-
-	dirEntries, err := os.ReadDir(directoryPath)
-	if err != nil {
-		errMsg := fmt.Sprintf("error reading directory %s: %v", directoryPath, err) // Changed: "Error" to "error"
-		log.Println(errMsg)
-		return errMsg
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.loadCancel != nil { // Started by another call while the dialog was open
+		return "", fmt.Errorf("a document load is already in progress")
 	}
+	log.Printf("User selected directory: %s. Starting to load personal data.", directoryPath)
 
-	for _, entry := range dirEntries {
-		if !entry.IsDir() && strings.HasSuffix(strings.ToLower(entry.Name()), ".txt") {
-			filePath := filepath.Join(directoryPath, entry.Name())
-			log.Printf("Processing file: %s", filePath)
+	jobCtx, cancel := context.WithCancel(a.ctx)
+	a.loadCancel = cancel
+	go a.runLoadJob(jobCtx, directoryPath, a.settings.Load)
 
-			content, err := os.ReadFile(filePath)
-			if err != nil {
-				log.Printf("Error reading file %s: %v. Skipping.", filePath, err)
-				continue // Skip this file and continue with the next
-			}
+	return fmt.Sprintf("Loading documents from %s...", directoryPath), nil
+}
 
-			// Define chunking parameters (could be made configurable later)
-			// Old word-based chunking:
-			// chunkSizeWords := 200 // Example: 200 words per chunk
-			// overlapWords := 20    // Example: 20 words overlap
-			// textChunks := chunkText(string(content), chunkSizeWords, overlapWords)
-
-			// New character-based recursive chunking:
-			textChunks := chunkTextRecursive(string(content), defaultChunkSizeChars, defaultOverlapChars)
-			log.Printf("File %s split into %d chunks using recursive strategy.", filePath, len(textChunks))
-
-			for _, chunkText := range textChunks {
-				if strings.TrimSpace(chunkText) == "" {
-					log.Printf("Skipping empty or whitespace-only chunk from file %s", filePath)
-					continue // Skip empty chunks
-				}
-
-				embedding, err := a.getOllamaEmbedding(chunkText)
-				if err != nil {
-					log.Printf("Error getting embedding for a chunk from %s: %v. Skipping chunk.", filePath, err)
-					continue // Skip this chunk
-				}
-
-				newChunk := DocumentChunk{
-					ID:         a.nextDocumentID,
-					Text:       chunkText,
-					Embedding:  embedding,
-					SourceFile: entry.Name(), // Store just the file name as source
-				}
-				a.documentStore = append(a.documentStore, newChunk)
-				a.nextDocumentID++
-				chunksLoaded++
-			}
-			filesProcessed++
-		}
+// CancelLoad is a Wails-bindable method that stops the running document load, if any.
+// Files indexed before cancellation are kept. It reports whether a load was running.
+func (a *App) CancelLoad() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.loadCancel == nil {
+		return false
 	}
-
-	statusMessage := fmt.Sprintf("Successfully processed %d files, loaded %d chunks into document store from %s.", filesProcessed, chunksLoaded, directoryPath)
-	log.Println(statusMessage)
-	return statusMessage
+	log.Println("CancelLoad called. Stopping document load.")
+	a.loadCancel()
+	return true
 }
 
-// cosineSimilarity calculates the cosine similarity between two vectors.
-func cosineSimilarity(vecA, vecB []float64) (float64, error) {
+// cosineSimilarity calculates the cosine similarity between two unit-length vectors,
+// which is their dot product. Embeddings are normalised when they are stored (see
+// unitEmbedding), so the magnitudes don't need to be computed for every comparison.
+func cosineSimilarity(vecA, vecB []float32) (float64, error) {
 	if len(vecA) != len(vecB) {
 		return 0, fmt.Errorf("vectors must have the same length (A: %d, B: %d)", len(vecA), len(vecB))
 	}
 	if len(vecA) == 0 {
 		return 0, fmt.Errorf("vectors must not be empty")
 	}
-
-	dotProduct := 0.0
-	magnitudeA := 0.0
-	magnitudeB := 0.0
-
-	for i := 0; i < len(vecA); i++ {
-		dotProduct += vecA[i] * vecB[i]
-		magnitudeA += vecA[i] * vecA[i]
-		magnitudeB += vecB[i] * vecB[i]
-	}
-
-	magnitudeA = math.Sqrt(magnitudeA)
-	magnitudeB = math.Sqrt(magnitudeB)
-
-	if magnitudeA == 0 || magnitudeB == 0 {
-		// If one vector is a zero vector, similarity is undefined or can be considered 0.
-		// Depending on the use case, returning an error might also be appropriate.
-		// For RAG, if a document chunk somehow had a zero embedding (unlikely with good models),
-		// it would simply have zero similarity to any query.
-		return 0, nil
-	}
-
-	return dotProduct / (magnitudeA * magnitudeB), nil
+	return float64(dotProduct(vecA, vecB)), nil
 }
 
 // rankedChunk holds a DocumentChunk and its similarity score for sorting.
@@ -498,57 +546,75 @@ type rankedChunk struct {
 	score float64
 }
 
-// findRelevantChunks finds the top N most similar document chunks to a query embedding.
-
-func (a *App) findRelevantChunks(queryEmbedding []float64, topN int) []DocumentChunk {
-	if len(a.documentStore) == 0 {
-		log.Println("Document store is empty. Cannot find relevant chunks.")
-		return []DocumentChunk{}
-	}
-	if topN <= 0 {
-		topN = 3 // Default to top 3 if not specified or invalid
+// retrievalOptions returns the retrieval options for the next question. While the index
+// is stale its embeddings cannot be compared with the query's, so only keyword search
+// is used, with the keyword minimum score.
+func (a *App) retrievalOptions() RetrievalOptions {
+	options := a.currentSettings().Retrieval
+	if a.indexStale() && options.Mode != retrievalKeyword {
+		log.Println("Document index is stale; using keyword search only until documents are reloaded.")
+		options.Mode = retrievalKeyword
 	}
+	return options
+}
 
-	var rankedChunks []rankedChunk
+// findRelevantChunks finds the document chunks most relevant to a question with the
+// retrieval mode of options, among the chunks passing filter.
+func (a *App) findRelevantChunks(queryEmbedding []float32, query string, options RetrievalOptions, filter chunkFilter) []DocumentChunk {
+	return a.store.Search(queryEmbedding, query, options, filter)
+}
 
-	for _, chunk := range a.documentStore {
-		if len(chunk.Embedding) == 0 {
-			log.Printf("Skipping chunk ID %d from %s due to empty embedding.", chunk.ID, chunk.SourceFile)
-			continue
-		}
-		similarity, err := cosineSimilarity(queryEmbedding, chunk.Embedding)
-		if err != nil {
-			log.Printf("Error calculating similarity for chunk ID %d (%s): %v. Skipping.", chunk.ID, chunk.SourceFile, err)
-			continue
-		}
-		rankedChunks = append(rankedChunks, rankedChunk{chunk: chunk, score: similarity})
+// ollamaChatComplete sends a non-streaming request to Ollama's chat API and returns the
+// whole answer, at most maxTokens long. It is used for short internal prompts of a
+// generation, not for answers shown to the user: it runs with the generation's model
+// and context, so StopGeneration aborts it, and with internalOptions rather than the
+// options meant for the answer.
+func (a *App) ollamaChatComplete(gen *generation, messages []OllamaChatMessage, maxTokens int) (string, error) {
+	requestBody, err := json.Marshal(OllamaChatRequest{
+		Model:     gen.model,
+		Messages:  messages,
+		Stream:    false,
+		Options:   gen.options.internalOptions(maxTokens),
+		KeepAlive: gen.options.ollamaKeepAlive(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error marshalling ollama request: %w", err)
 	}
 
-	// Sort chunks by score in descending order
-	sort.Slice(rankedChunks, func(i, j int) bool {
-		return rankedChunks[i].score > rankedChunks[j].score
-	})
+	req, err := http.NewRequestWithContext(gen.ctx, "POST", a.ollamaURL("chat"), bytes.NewBuffer(requestBody))
+	if err != nil {
+		return "", fmt.Errorf("error creating ollama request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error sending request to ollama: %w", err)
+	}
+	defer resp.Body.Close()
 
-	numToReturn := min(topN, len(rankedChunks))
-	resultChunks := make([]DocumentChunk, numToReturn)
-	for i := 0; i < numToReturn; i++ {
-		// Assign the chunk and its calculated score to the result
-		chunkWithScore := rankedChunks[i].chunk
-		chunkWithScore.Score = rankedChunks[i].score // Explicitly set the score
-		resultChunks[i] = chunkWithScore
-		log.Printf("Selected relevant chunk %d: ID %d, Source: %s, Score: %.4f", i+1, resultChunks[i].ID, resultChunks[i].SourceFile, resultChunks[i].Score)
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("ollama API request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
 	}
 
-	return resultChunks
+	var ollamaResp OllamaChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ollamaResp); err != nil {
+		return "", fmt.Errorf("error unmarshalling ollama response: %w", err)
+	}
+	return ollamaResp.Message.Content, nil
 }
 
 // askOllamaChatRaw sends a request to Ollama's chat API and streams the response via Wails events.
-// It should be run in a goroutine.
-func (a *App) askOllamaChatRaw(messages []OllamaChatMessage) { // Changed parameter type to OllamaChatMessage
+// It should be run in a goroutine. It returns the final 'done' event with Content set to
+// the whole streamed answer, which is partial if the stream failed or was stopped.
+// Cancelling the generation aborts the HTTP stream; the final event is then marked as cancelled.
+func (a *App) askOllamaChatRaw(gen *generation, messages []OllamaChatMessage) (final OllamaStreamEvent) { // Changed parameter type to OllamaChatMessage
+	ctx := gen.ctx
 	startTime := time.Now()
 	totalRunes := 0
 	var finalErrorMessage string
-	var accumulatedContent strings.Builder // Accumulate content here for the final event if needed, or just for rune counting
+	var accumulatedContent strings.Builder // Whole answer so far, returned to the caller in the final event
 
 	// Ensure a final "done" event is sent when this function exits, regardless of path.
 	defer func() {
@@ -562,23 +628,26 @@ func (a *App) askOllamaChatRaw(messages []OllamaChatMessage) { // Changed parame
 		log.Printf("askOllamaChatRaw finished. Total runes: %d, Duration: %s (%.2f ms), Runes/s: %.2f. Sending final 'done' event.",
 			totalRunes, duration, float64(durationMs), runesPerSecond)
 
-		// The 'Content' field in this final 'done' event can be empty if all content was streamed progressively.
-		// Or, if frontend prefers, accumulatedContent.String() could be sent here.
-		// For now, individual chunks are sent, and this final event just signals completion and metrics.
-		runtime.EventsEmit(a.ctx, "ollamaStreamEvent", OllamaStreamEvent{
+		// The frontend already has the answer from the streamed chunks, so the 'done' event
+		// it receives only signals completion and carries the metrics.
+		final = OllamaStreamEvent{
 			Done:           true,
 			Error:          finalErrorMessage,
 			DurationMs:     durationMs,
 			RunesPerSecond: runesPerSecond,
-			// Content: accumulatedContent.String(), // Optionally send all content again, or leave for progressive updates
-		})
+			Cancelled:      ctx.Err() != nil, // Stopped by StopGeneration (or the app shutting down)
+		}
+		a.emitStreamEvent(gen, final)
+		final.Content = accumulatedContent.String() // Returned to the caller only
 	}()
 
-	ollamaChatURL := ollamaApiUrl + "/chat" // Corrected URL construction
+	ollamaChatURL := a.ollamaURL("chat")
 	requestPayload := OllamaChatRequest{
-		Model:    chatModelName, // chatModelName is const
-		Messages: messages,
-		Stream:   true,
+		Model:     gen.model,
+		Messages:  messages,
+		Stream:    true,
+		Options:   gen.options.ollamaOptions(),
+		KeepAlive: gen.options.ollamaKeepAlive(),
 	}
 
 	requestBody, err := json.Marshal(requestPayload)
@@ -592,8 +661,8 @@ func (a *App) askOllamaChatRaw(messages []OllamaChatMessage) { // Changed parame
 
 	log.Printf("Sending request to Ollama: %s", string(requestBody))
 
-	// Use a.ctx for the request, so it can be cancelled if the app shuts down.
-	req, err := http.NewRequestWithContext(a.ctx, "POST", ollamaChatURL, bytes.NewBuffer(requestBody))
+	// Use the generation's context, so StopGeneration (or the app shutting down) aborts the stream.
+	req, err := http.NewRequestWithContext(ctx, "POST", ollamaChatURL, bytes.NewBuffer(requestBody))
 	if err != nil {
 		errMsg := fmt.Sprintf("error creating ollama request: %v", err)
 		log.Println(errMsg)
@@ -605,11 +674,10 @@ func (a *App) askOllamaChatRaw(messages []OllamaChatMessage) { // Changed parame
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		// Check for context cancellation (e.g., app closing)
-		if a.ctx.Err() != nil {
-			log.Printf("Ollama request cancelled (context error): %v", a.ctx.Err())
-			// No need to set finalErrorMessage if app is closing, defer will send done.
-			// finalErrorMessage = fmt.Sprintf("Request cancelled: %v", a.ctx.Err()) // Or set it if you want to show this specific error
+		// Check for context cancellation (e.g., StopGeneration or app closing)
+		if ctx.Err() != nil {
+			log.Printf("Ollama request cancelled (context error): %v", ctx.Err())
+			// Not an error: the deferred 'done' event is marked as cancelled instead.
 			return
 		}
 		errMsg := fmt.Sprintf("error sending request to ollama: %v", err)
@@ -633,10 +701,9 @@ func (a *App) askOllamaChatRaw(messages []OllamaChatMessage) { // Changed parame
 	streamEndedByOllama := false // Flag to track if Ollama itself signaled completion
 	for scanner.Scan() {
 		// Check context in loop to allow for cancellation during long streams
-		if a.ctx.Err() != nil {
-			log.Printf("Stream processing cancelled (context error): %v", a.ctx.Err())
-			// finalErrorMessage = fmt.Sprintf("Stream cancelled: %v", a.ctx.Err()) // Optional: set error message
-			return // Exit, defer will send final done event
+		if ctx.Err() != nil {
+			log.Printf("Stream processing cancelled (context error): %v", ctx.Err())
+			return // The deferred 'done' event is marked as cancelled
 		}
 		line := scanner.Bytes()
 		if len(line) == 0 {
@@ -655,8 +722,8 @@ func (a *App) askOllamaChatRaw(messages []OllamaChatMessage) { // Changed parame
 
 		if ollamaResp.Message.Content != "" {
 			totalRunes += utf8.RuneCountInString(ollamaResp.Message.Content)
-			accumulatedContent.WriteString(ollamaResp.Message.Content)        // Keep accumulating for accurate total rune count
-			runtime.EventsEmit(a.ctx, "ollamaStreamEvent", OllamaStreamEvent{ // Use struct
+			accumulatedContent.WriteString(ollamaResp.Message.Content)
+			a.emitStreamEvent(gen, OllamaStreamEvent{ // Use struct
 				Content: ollamaResp.Message.Content,
 				Done:    false, // This is an intermediate chunk
 			})
@@ -671,7 +738,7 @@ func (a *App) askOllamaChatRaw(messages []OllamaChatMessage) { // Changed parame
 
 	if err := scanner.Err(); err != nil && err != io.EOF {
 		// Don't send error if context was cancelled, as that's the primary error reason.
-		if a.ctx.Err() == nil {
+		if ctx.Err() == nil {
 			errMsg := fmt.Sprintf("error reading stream response: %v", err)
 			log.Println(errMsg)
 			// a.sendErrorEvent(errMsg) // Deprecated
@@ -688,91 +755,170 @@ func (a *App) askOllamaChatRaw(messages []OllamaChatMessage) { // Changed parame
 		// The defer function will still send a 'done' event with metrics.
 	}
 	// Normal exit: defer function sends the final done event with metrics.
+	return
+}
+
+// HandleMessage is called when the user sends a message in a conversation.
+// It is HandleMessageWithOptions with the generation options from the settings.
+func (a *App) HandleMessage(conversationID string, userInput string) (string, error) {
+	return a.HandleMessageWithOptions(conversationID, userInput, GenerationOptions{})
+}
+
+// HandleMessageWithOptions is HandleMessage with generation options for this request
+// only. Options that are set override the ones from the settings; for example a
+// temperature of 0 and a fixed seed make the answer reproducible for audit.
+// It starts answering in the background and returns the request ID, which is set on
+// every ollamaStreamEvent and ragSourcesEvent of the answer and accepted by
+// StopGeneration.
+//
+// Concurrency rules: messages of the same conversation are answered one after the
+// other, in the order they were sent, since each answer becomes history for the next.
+// Different conversations are answered in parallel up to ChatOptions.MaxConcurrentGenerations;
+// further requests wait in a first-come, first-served queue.
+func (a *App) HandleMessageWithOptions(conversationID string, userInput string, options GenerationOptions) (string, error) {
+	return a.handleMessage(conversationID, userInput, options, chunkFilter{})
+}
+
+// HandleMessageWithFilter is a Wails-bindable method that is HandleMessageWithOptions
+// with retrieval restricted to the chunks whose metadata matches a filter expression,
+// such as "patient:1234 type:cardiology" to answer "latest echo report for patient
+// 1234" from that patient's cardiology documents only. See parseChunkFilter for the
+// syntax; an empty expression searches every document, and empty options use the
+// settings.
+func (a *App) HandleMessageWithFilter(conversationID string, userInput string, options GenerationOptions, filter string) (string, error) {
+	parsed, err := parseChunkFilter(filter)
+	if err != nil {
+		return "", fmt.Errorf("invalid filter: %w", err)
+	}
+	if !parsed.empty() {
+		log.Printf("Restricting retrieval to chunks matching filter %q", filter)
+	}
+	return a.handleMessage(conversationID, userInput, options, parsed)
 }
 
-// HandleMessage is called when the user sends a message.
-// It processes the input, performs RAG, and triggers AI response streaming.
-func (a *App) HandleMessage(userInput string) error {
-	log.Printf("HandleMessage received: %s", userInput)
+// handleMessage queues the answer to a message, with per-request generation options
+// and retrieval filter, and returns the request ID.
+func (a *App) handleMessage(conversationID string, userInput string, options GenerationOptions, filter chunkFilter) (string, error) {
+	log.Printf("HandleMessage received for conversation %q: %s", conversationID, userInput)
+	if strings.TrimSpace(userInput) == "" {
+		return "", errors.New("message must not be empty")
+	}
+	if err := a.checkBackendAvailable(); err != nil {
+		log.Printf("Rejected message: %v", err)
+		return "", err
+	}
 
-	// 1. Get embedding for the user input
-	queryEmbedding, err := a.getOllamaEmbedding(userInput)
+	options.normalize()
+	if err := options.validate(); err != nil {
+		return "", fmt.Errorf("invalid generation options: %w", err)
+	}
+
+	conv := a.conversation(conversationID)
+	settings := a.currentSettings()
+	gen := a.startGeneration(conv.ID, settings.ChatModel, settings.Generation.merge(options))
+	gen.filter = filter
+	go func() {
+		defer a.finishGeneration(gen.requestID)
+		a.answerMessage(gen, conv, userInput)
+	}()
+	return gen.requestID, nil
+}
+
+// answerMessage processes the input, performs RAG, and streams the AI response.
+// Previous turns of the conversation (trimmed to a token budget) are sent along, and
+// follow-up questions are rewritten into standalone queries for retrieval.
+func (a *App) answerMessage(gen *generation, conv *Conversation, userInput string) {
+	// Wait for earlier messages of this conversation, then for a free generation slot.
+	conv.turnMu.Lock()
+	defer conv.turnMu.Unlock()
+	if err := a.acquireGenerationSlot(gen); err != nil {
+		log.Printf("Request %s stopped while queued: %v", gen.requestID, err)
+		a.emitStreamEvent(gen, OllamaStreamEvent{Done: true, Cancelled: true})
+		return
+	}
+	defer a.limiter.release()
+
+	history := conv.History(gen.options.historyBudget())
+	retrievalQuery := a.standaloneQuery(gen, history, userInput)
+
+	// 1. Get embedding for the (standalone) user input, unless only keywords are searched
+	retrieval := a.retrievalOptions()
+	var queryEmbedding []float32
+	var err error
+	if retrieval.Mode != retrievalKeyword {
+		var embedding []float64
+		embedding, err = a.getOllamaEmbedding(retrievalQuery)
+		queryEmbedding = unitEmbedding(embedding)
+	}
 	if err != nil {
 		errMsg := fmt.Sprintf("Error getting embedding for your message: %v", err)
 		log.Println(errMsg)
+		a.recheckHealth() // Report an outage right away rather than at the next poll
 		// Send an error event to the frontend immediately
-		runtime.EventsEmit(a.ctx, "ollamaStreamEvent", OllamaStreamEvent{
+		a.emitStreamEvent(gen, OllamaStreamEvent{
 			Error: errMsg,
 			Done:  true, // Signal completion of this attempt
 		})
-		return fmt.Errorf("%s", errMsg) // Also return error to Wails caller
+		return
 	}
 
 	// 2. Find relevant chunks
-	topN := 3 // Number of relevant chunks to retrieve
-	log.Printf("Finding top %d relevant chunks for input: '%s'", topN, userInput)
-	relevantChunks := a.findRelevantChunks(queryEmbedding, topN)
-
-	// Prepare source information for the frontend
-	sourceInfos := make([]SourceInfo, 0, len(relevantChunks))
-	for _, chunk := range relevantChunks {
-		sourceInfos = append(sourceInfos, SourceInfo{
-			FileName: chunk.SourceFile,
-			ChunkID:  chunk.ID,
-			Score:    chunk.Score,
-		})
+	searchOptions := retrieval
+	searchOptions.TopN = retrieval.candidates()
+	log.Printf("Finding top %d relevant chunks (%s retrieval) for input: '%s'", searchOptions.TopN, retrieval.Mode, retrievalQuery)
+	relevantChunks := a.findRelevantChunks(queryEmbedding, retrievalQuery, searchOptions, gen.filter)
+	if retrieval.Rerank {
+		relevantChunks = a.rerankChunks(gen, retrievalQuery, relevantChunks, retrieval)
+	}
+	relevantChunks = retrieval.selectChunks(relevantChunks)
+
+	// 3. Keep the chunks that are relevant enough on their own and close enough to the best one
+	contextChunks, skipped := retrieval.filterChunks(relevantChunks)
+	if len(relevantChunks) == 0 {
+		log.Println("No relevant chunks found. Using original user input.")
+	} else {
+		log.Printf("Using %d of %d retrieved chunks as RAG context (min score %.2f, relative cutoff %.2f)",
+			len(contextChunks), len(relevantChunks), retrieval.minScoreFor(relevantChunks[0]), retrieval.RelativeCutoff)
 	}
 
+	// 4. Fit the chunks into the context window of the conversation's prompt template
+	promptTemplate := a.promptTemplate(conv.TemplateName())
+	contextChunks = a.fitContext(gen, promptTemplate, history, userInput, contextChunks)
+
+	// Prepare source information for the frontend, marking what the model will see
+	sources := sourceInfos(relevantChunks, contextChunks, skipped)
+
 	// Emit an event with RAG sources *before* starting the AI response stream
 	// This allows the UI to display sources immediately.
-	if len(sourceInfos) > 0 {
-		log.Printf("Emitting %d RAG sources via 'ragSourcesEvent'", len(sourceInfos))
-		runtime.EventsEmit(a.ctx, "ragSourcesEvent", sourceInfos)
+	if len(sources) > 0 {
+		log.Printf("Emitting %d RAG sources via 'ragSourcesEvent'", len(sources))
 	} else {
 		log.Println("No RAG sources found to emit.")
-		// Emit an empty slice if no sources are found, so frontend can clear previous sources
-		runtime.EventsEmit(a.ctx, "ragSourcesEvent", []SourceInfo{})
-	}
-
-	// 3. Construct context from relevant chunks if they meet the threshold
-	var finalPrompt string
-	useRAGContext := false
-	if len(relevantChunks) > 0 && relevantChunks[0].Score >= ragRelevanceThreshold {
-		useRAGContext = true
-	}
-
-	if useRAGContext {
-		var contextBuilder strings.Builder
-		contextBuilder.WriteString("Use the following context to answer the user's question:\\n\\n")
-		for i, chunk := range relevantChunks {
-			// Only include chunks that meet the threshold, though findRelevantChunks already sorts them
-			// and we are primarily concerned with the top one for deciding to use RAG at all.
-			// For simplicity here, if we decide to use RAG, we use all chunks returned by findRelevantChunks.
-			// A more advanced strategy could filter chunks within the loop based on individual scores.
-			contextBuilder.WriteString(fmt.Sprintf("Context from document '%s' (Chunk %d, Relevance: %.2f):\\n", chunk.SourceFile, chunk.ID, chunk.Score))
-			contextBuilder.WriteString(chunk.Text)
-			if i < len(relevantChunks)-1 {
-				contextBuilder.WriteString("\\n\\n---\\n\\n") // Separator between chunks
-			} else {
-				contextBuilder.WriteString("\\n\\n")
-			}
-		}
-		contextBuilder.WriteString(fmt.Sprintf("User's question: %s", userInput))
-		finalPrompt = contextBuilder.String()
-		log.Printf("Constructed RAG context (length: %d chars) as top score %.4f >= %.2f", len(finalPrompt), relevantChunks[0].Score, ragRelevanceThreshold)
-	} else {
-		if len(relevantChunks) > 0 { // Relevant chunks were found, but score was too low
-			log.Printf("Relevant chunks found, but top score %.4f < %.2f. Skipping RAG context. Using original user input.", relevantChunks[0].Score, ragRelevanceThreshold)
-		} else { // No relevant chunks were found
-			log.Println("No relevant chunks found. Using original user input.")
-		}
-		finalPrompt = userInput
+		// An empty list is still emitted, so frontend can clear previous sources
 	}
+	runtime.EventsEmit(a.ctx, "ragSourcesEvent", RagSourcesEvent{
+		RequestID:      gen.requestID,
+		ConversationID: gen.conversationID,
+		Sources:        sources,
+	})
 
-	// 4. Call the LLM with the (potentially augmented) prompt
-	messages := []OllamaChatMessage{{Role: "user", Content: finalPrompt}}
-	log.Printf("Calling askOllamaChatRaw with LLM prompt (first 100 chars of user content): %s...", finalPrompt[:min(len(finalPrompt), 100)])
-	go a.askOllamaChatRaw(messages)
-
-	return nil
+	// 5. Call the LLM with the prompt template, the conversation history and the chunks
+	messages := promptTemplate.buildMessages(history, newPromptData(userInput, contextChunks))
+	finalPrompt := messages[len(messages)-1].Content
+	log.Printf("Calling askOllamaChatRaw with template %q, %d history messages and LLM prompt (first 100 chars of user content): %s...", promptTemplate.Name, len(history), finalPrompt[:min(len(finalPrompt), 100)])
+	final := a.askOllamaChatRaw(gen, messages)
+	// Store the original question rather than the RAG prompt, so history stays compact.
+	// Failed and stopped answers are saved too, so the session shows what happened.
+	if strings.TrimSpace(final.Content) != "" || final.Error != "" || final.Cancelled {
+		conv.AddTurn(userInput, SessionMessage{
+			Content:        final.Content,
+			Sources:        sources,
+			DurationMs:     final.DurationMs,
+			RunesPerSecond: final.RunesPerSecond,
+			Error:          final.Error,
+			Cancelled:      final.Cancelled,
+			Model:          gen.model,
+			Options:        &gen.options,
+		})
+	}
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestHandleMessageWithFilterChecksOptionsAndFilter(t *testing.T) {
+	zero, temperature := 0, 0.2
+	tests := []struct {
+		name    string
+		input   string
+		options GenerationOptions
+		filter  string
+		wantErr string
+	}{
+		{"empty message", " ", GenerationOptions{}, "patient:1234", "message must not be empty"},
+		{"invalid filter", "Latest echo?", GenerationOptions{Temperature: &temperature}, "patient:", "invalid filter"},
+		{"invalid options", "Latest echo?", GenerationOptions{NumPredict: &zero}, "patient:1234 type:cardiology", "invalid generation options"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewApp()
+			requestID, err := a.HandleMessageWithFilter("c", tt.input, tt.options, tt.filter)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("HandleMessageWithFilter() = %q, %v; want an error containing %q", requestID, err, tt.wantErr)
+			}
+			if len(a.generations) != 0 {
+				t.Errorf("a rejected message started %d generations", len(a.generations))
+			}
+		})
+	}
+}
+
+func TestConcurrentSettingsUpdatesSaveLatest(t *testing.T) {
+	a := NewApp()
+	a.settingsPath = filepath.Join(t.TempDir(), settingsFileName)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := a.updateSettings(func(s *Settings) { s.ChatModel = fmt.Sprintf("model-%d", i) }); err != nil {
+				t.Errorf("updateSettings() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(a.settingsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved Settings
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if current := a.currentSettings().ChatModel; saved.ChatModel != current {
+		t.Errorf("saved chat model = %q, want the one in effect, %q", saved.ChatModel, current)
+	}
+}
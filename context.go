@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	defaultNumCtx              = 2048 // Context window Ollama uses when num_ctx is not set
+	defaultAnswerReserveTokens = 512  // Tokens kept free for the answer when num_predict is not set
+	minTrimmedChunkTokens      = 64   // A chunk is only trimmed to fit if at least this much of it remains
+	trimmedChunkMarker         = " […]"
+)
+
+// ContextChunkReport describes one retrieved chunk in a ContextBudgetEvent.
+type ContextChunkReport struct {
+	ChunkID  int     `json:"chunkId"`
+	FileName string  `json:"fileName"`
+	Page     int     `json:"page,omitempty"`
+	Score    float64 `json:"score"`
+	Tokens   int     `json:"tokens"`            // Estimated tokens sent, after trimming; for dropped chunks the full size
+	Trimmed  bool    `json:"trimmed,omitempty"` // Only the beginning of the chunk was sent
+	Reason   string  `json:"reason,omitempty"`  // Why a chunk was dropped
+}
+
+// ContextBudgetEvent is the payload of contextBudgetEvent, sent before an answer is
+// streamed to show which retrieved chunks fit into the model's context window.
+type ContextBudgetEvent struct {
+	RequestID      string               `json:"requestId"`
+	ConversationID string               `json:"conversationId"`
+	ContextWindow  int                  `json:"contextWindow"` // num_ctx of the request, in tokens
+	BudgetTokens   int                  `json:"budgetTokens"`  // Tokens left for chunks after the system prompt, history, question and answer
+	UsedTokens     int                  `json:"usedTokens"`
+	Chosen         []ContextChunkReport `json:"chosen"`
+	Dropped        []ContextChunkReport `json:"dropped"`
+}
+
+// contextWindow returns the context window of a request in tokens.
+func (o GenerationOptions) contextWindow() int {
+	if o.NumCtx != nil {
+		return *o.NumCtx
+	}
+	return defaultNumCtx
+}
+
+// answerReserve returns the tokens to keep free for the answer in a context window.
+func (o GenerationOptions) answerReserve(window int) int {
+	reserve := defaultAnswerReserveTokens
+	if o.NumPredict != nil && *o.NumPredict > 0 {
+		reserve = *o.NumPredict
+	}
+	return min(reserve, window/2) // Never let the answer crowd out the question
+}
+
+// historyBudget returns the tokens of previous turns sent with a question, so history
+// never takes more than a quarter of the context window.
+func (o GenerationOptions) historyBudget() int {
+	return min(defaultHistoryTokenBudget, o.contextWindow()/4)
+}
+
+// chunkBudget works out how many tokens are left for retrieved chunks once the rest of
+// the request is accounted for: the system prompt, history, the rendered question
+// with chunk headers and source lines, and the answer.
+func chunkBudget(options GenerationOptions, tmpl PromptTemplate, history []OllamaChatMessage, question string, chunks []DocumentChunk) int {
+	window := options.contextWindow()
+	used := estimateTokens(tmpl.SystemPrompt) + options.answerReserve(window)
+	for _, msg := range history {
+		used += estimateTokens(msg.Content)
+	}
+
+	// Render the template with empty chunk texts to measure everything but the texts.
+	headers := make([]DocumentChunk, len(chunks))
+	for i, chunk := range chunks {
+		headers[i] = chunk
+		headers[i].Text = ""
+	}
+	if prompt, err := tmpl.render(newPromptData(question, headers)); err == nil {
+		used += estimateTokens(prompt)
+	} else {
+		used += estimateTokens(question)
+	}
+	return max(0, window-used)
+}
+
+// assembleContext fills a token budget with chunks in the order given, which callers
+// sort by value. A chunk that does not fit is trimmed if enough of it would remain,
+// and dropped otherwise; smaller chunks further down may still fit after it.
+func assembleContext(chunks []DocumentChunk, budget int) ([]DocumentChunk, ContextBudgetEvent) {
+	report := ContextBudgetEvent{BudgetTokens: budget, Chosen: []ContextChunkReport{}, Dropped: []ContextChunkReport{}}
+	chosen := make([]DocumentChunk, 0, len(chunks))
+	remaining := budget
+	for _, chunk := range chunks {
+		tokens := estimateTokens(chunk.Text)
+		entry := ContextChunkReport{ChunkID: chunk.ID, FileName: chunk.SourceFile, Page: chunk.Page, Score: chunk.Score, Tokens: tokens}
+		switch {
+		case tokens <= remaining:
+			chosen = append(chosen, chunk)
+		case remaining >= minTrimmedChunkTokens:
+			chunk.Text = trimToTokens(chunk.Text, remaining-estimateTokens(trimmedChunkMarker)) + trimmedChunkMarker
+			tokens = estimateTokens(chunk.Text)
+			entry.Tokens = tokens
+			entry.Trimmed = true
+			chosen = append(chosen, chunk)
+		default:
+			entry.Reason = fmt.Sprintf("needs %d tokens, %d left", tokens, remaining)
+			report.Dropped = append(report.Dropped, entry)
+			continue
+		}
+		remaining -= tokens
+		report.UsedTokens += tokens
+		report.Chosen = append(report.Chosen, entry)
+	}
+	return chosen, report
+}
+
+// trimToTokens shortens text to about the given number of tokens, cutting at the last
+// word boundary.
+func trimToTokens(text string, tokens int) string {
+	runes := []rune(text)
+	limit := tokens * approxCharsPerToken
+	if limit >= len(runes) {
+		return text
+	}
+	cut := limit
+	for cut > 0 && !unicode.IsSpace(runes[cut]) {
+		cut--
+	}
+	if cut == 0 {
+		cut = limit // A single long word; cut inside it
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace)
+}
+
+// budgetContext chooses the chunks that fit into the context window of a request and
+// describes the choice in the contextBudgetEvent for it.
+func budgetContext(gen *generation, tmpl PromptTemplate, history []OllamaChatMessage, question string, chunks []DocumentChunk) ([]DocumentChunk, ContextBudgetEvent) {
+	budget := chunkBudget(gen.options, tmpl, history, question, chunks)
+	chosen, report := assembleContext(chunks, budget)
+	report.RequestID = gen.requestID
+	report.ConversationID = gen.conversationID
+	report.ContextWindow = gen.options.contextWindow()
+	return chosen, report
+}
+
+// fitContext chooses the chunks that fit into the context window of a request and
+// reports the choice to the frontend as contextBudgetEvent.
+func (a *App) fitContext(gen *generation, tmpl PromptTemplate, history []OllamaChatMessage, question string, chunks []DocumentChunk) []DocumentChunk {
+	if len(chunks) == 0 {
+		return chunks
+	}
+	chosen, report := budgetContext(gen, tmpl, history, question, chunks)
+	log.Printf("Context budget of %d tokens (window %d): %d chunks chosen using %d tokens, %d dropped.",
+		report.BudgetTokens, report.ContextWindow, len(report.Chosen), report.UsedTokens, len(report.Dropped))
+	runtime.EventsEmit(a.ctx, "contextBudgetEvent", report)
+	return chosen
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// words returns text of the given number of estimated tokens, one word per token.
+func words(tokens int) string {
+	return strings.Repeat("abc ", tokens) // approxCharsPerToken characters per word
+}
+
+func TestTrimToTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		tokens int
+		want   string
+	}{
+		{"fits", "short text", 10, "short text"},
+		{"word boundary", "alpha beta gamma delta", 3, "alpha beta"},
+		{"single long word", "abcdefghijklmnop", 2, "abcdefgh"},
+		{"runes, not bytes", strings.Repeat("é", 20), 2, strings.Repeat("é", 8)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trimToTokens(tt.text, tt.tokens); got != tt.want {
+				t.Errorf("trimToTokens(%q, %d) = %q, want %q", tt.text, tt.tokens, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChunkBudget(t *testing.T) {
+	window, small, big, predict, large := 1000, 100, 2000, 100, 500
+	bare := PromptTemplate{Name: "bare", ContextTemplate: "Q", NoContextTemplate: "Q"}
+	tests := []struct {
+		name    string
+		options GenerationOptions
+		tmpl    PromptTemplate
+		history []OllamaChatMessage
+		want    int
+	}{
+		{"answer and question", GenerationOptions{NumCtx: &window, NumPredict: &predict}, bare, nil, 899},
+		{"default answer reserve", GenerationOptions{NumCtx: &big}, bare, nil, 2000 - defaultAnswerReserveTokens - 1},
+		{"history", GenerationOptions{NumCtx: &window, NumPredict: &predict}, bare, []OllamaChatMessage{{Role: "user", Content: words(100)}}, 799},
+		{"system prompt", GenerationOptions{NumCtx: &window, NumPredict: &predict}, PromptTemplate{SystemPrompt: words(50), ContextTemplate: "Q", NoContextTemplate: "Q"}, nil, 849},
+		{"answer at most half the window", GenerationOptions{NumCtx: &small, NumPredict: &large}, bare, nil, 49},
+		{"exhausted", GenerationOptions{NumCtx: &window, NumPredict: &predict}, PromptTemplate{SystemPrompt: words(2000), ContextTemplate: "Q", NoContextTemplate: "Q"}, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chunkBudget(tt.options, tt.tmpl, tt.history, "question", nil); got != tt.want {
+				t.Errorf("chunkBudget() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// Chunk headers count against the budget, chunk texts do not
+	tmpl := defaultPromptTemplates()[0]
+	options := GenerationOptions{NumCtx: &window}
+	short := []DocumentChunk{{ID: 1, SourceFile: "a.txt", Text: "short"}}
+	long := []DocumentChunk{{ID: 1, SourceFile: "a.txt", Text: words(500)}}
+	none := chunkBudget(options, tmpl, nil, "question", nil)
+	if got := chunkBudget(options, tmpl, nil, "question", short); got >= none || got != chunkBudget(options, tmpl, nil, "question", long) {
+		t.Errorf("chunkBudget() with a chunk = %d, want less than %d without and the same whatever its length", got, none)
+	}
+}
+
+func TestAssembleContext(t *testing.T) {
+	chunks := func(tokens ...int) []DocumentChunk {
+		var out []DocumentChunk
+		for i, n := range tokens {
+			out = append(out, DocumentChunk{ID: i + 1, SourceFile: "a.txt", Text: words(n)})
+		}
+		return out
+	}
+	tests := []struct {
+		name        string
+		chunks      []DocumentChunk
+		budget      int
+		wantChosen  []int
+		wantTrimmed int // ID of the trimmed chunk, if any
+		wantDropped []int
+		wantReason  string // Reason of the first dropped chunk
+	}{
+		{"all fit", chunks(10, 10), 100, []int{1, 2}, 0, nil, ""},
+		{"last chunk trimmed", chunks(100, 200), 180, []int{1, 2}, 2, nil, ""},
+		{"too little left to trim", chunks(100, 200, 10), 150, []int{1, 3}, 0, []int{2}, "needs 200 tokens, 50 left"},
+		{"budget exhausted", chunks(10, 10), 0, nil, 0, []int{1, 2}, "needs 10 tokens, 0 left"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chosen, report := assembleContext(tt.chunks, tt.budget)
+			if len(chosen) != len(tt.wantChosen) || len(report.Chosen) != len(tt.wantChosen) || len(report.Dropped) != len(tt.wantDropped) {
+				t.Fatalf("chose %d chunks, reported %d chosen and %d dropped; want %v chosen and %v dropped", len(chosen), len(report.Chosen), len(report.Dropped), tt.wantChosen, tt.wantDropped)
+			}
+			used := 0
+			for i, chunk := range chosen {
+				entry := report.Chosen[i]
+				if chunk.ID != tt.wantChosen[i] || entry.ChunkID != chunk.ID {
+					t.Errorf("chosen chunk %d (reported %d) at %d, want %v", chunk.ID, entry.ChunkID, i, tt.wantChosen)
+				}
+				if entry.Tokens != estimateTokens(chunk.Text) {
+					t.Errorf("chunk %d reported as %d tokens, sent %d", chunk.ID, entry.Tokens, estimateTokens(chunk.Text))
+				}
+				trimmed := chunk.ID == tt.wantTrimmed
+				if entry.Trimmed != trimmed || strings.HasSuffix(chunk.Text, trimmedChunkMarker) != trimmed {
+					t.Errorf("chunk %d trimmed = %t, text %q; want trimmed %t", chunk.ID, entry.Trimmed, chunk.Text, trimmed)
+				}
+				used += entry.Tokens
+			}
+			if report.UsedTokens != used || used > tt.budget || report.BudgetTokens != tt.budget {
+				t.Errorf("report uses %d of %d tokens, chunks use %d of %d", report.UsedTokens, report.BudgetTokens, used, tt.budget)
+			}
+			for i, entry := range report.Dropped {
+				if entry.ChunkID != tt.wantDropped[i] || entry.Tokens != estimateTokens(tt.chunks[entry.ChunkID-1].Text) {
+					t.Errorf("dropped %+v at %d, want chunk %d with its full size", entry, i, tt.wantDropped[i])
+				}
+			}
+			if len(report.Dropped) > 0 && report.Dropped[0].Reason != tt.wantReason {
+				t.Errorf("drop reason = %q, want %q", report.Dropped[0].Reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestBudgetContext(t *testing.T) {
+	// About 110 tokens are left for chunks: too few for the second after the first.
+	window, predict := 300, 100
+	gen := &generation{requestID: "r1", conversationID: "c1", options: GenerationOptions{NumCtx: &window, NumPredict: &predict}}
+	tmpl := PromptTemplate{Name: "test", SystemPrompt: words(50), ContextTemplate: "{{.Context}}", NoContextTemplate: "{{.Question}}"}
+	chunks := []DocumentChunk{
+		{ID: 7, SourceFile: "echo.txt", Page: 2, Score: 0.9, Text: words(100)},
+		{ID: 8, SourceFile: "labs.txt", Score: 0.8, Text: words(300)},
+	}
+
+	chosen, report := budgetContext(gen, tmpl, nil, "Latest LVEF?", chunks)
+	if report.RequestID != "r1" || report.ConversationID != "c1" || report.ContextWindow != window {
+		t.Errorf("event names request %q of %q with window %d, want r1 of c1 with %d", report.RequestID, report.ConversationID, report.ContextWindow, window)
+	}
+	if want := chunkBudget(gen.options, tmpl, nil, "Latest LVEF?", chunks); report.BudgetTokens != want {
+		t.Errorf("event budget = %d, want %d", report.BudgetTokens, want)
+	}
+	if len(chosen) != 1 || len(report.Chosen) != 1 || len(report.Dropped) != 1 {
+		t.Fatalf("chose %d chunks, reported %d chosen and %d dropped; want the first chosen and the second dropped", len(chosen), len(report.Chosen), len(report.Dropped))
+	}
+	want := ContextChunkReport{ChunkID: 7, FileName: "echo.txt", Page: 2, Score: 0.9, Tokens: 100}
+	if report.Chosen[0] != want {
+		t.Errorf("chosen chunk report = %+v, want %+v", report.Chosen[0], want)
+	}
+	if dropped := report.Dropped[0]; dropped.ChunkID != 8 || dropped.FileName != "labs.txt" || dropped.Tokens != 300 || dropped.Reason == "" {
+		t.Errorf("dropped chunk report = %+v, want chunk 8 of labs.txt with its 300 tokens and a reason", dropped)
+	}
+}
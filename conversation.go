@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultHistoryTokenBudget = 2048 // Approximate tokens of previous turns sent with each question
+	approxCharsPerToken       = 4    // Rough characters-per-token ratio used for budgeting
+	defaultConversationID     = "default"
+	standaloneQueryMaxTokens  = 128 // Answer length allowed for a rewritten follow-up question
+)
+
+// standaloneQueryPrompt asks the chat model to turn a follow-up into a question that
+// can be embedded on its own.
+const standaloneQueryPrompt = `Given the conversation below and a follow-up question, rewrite the follow-up question as a single standalone question that can be understood without the conversation. Replace pronouns and references such as "he", "his", "that drug" or "the last result" with what they refer to. Do not answer the question. Reply with the rewritten question only.
+
+Conversation:
+%s
+Follow-up question: %s
+
+Standalone question:`
+
+// SessionMessage is one message of a conversation, together with what the UI showed
+// alongside it, so a saved session can be displayed again as it was.
+type SessionMessage struct {
+	Role           string             `json:"role"` // "user" or "assistant"
+	Content        string             `json:"content"`
+	Sources        []SourceInfo       `json:"sources,omitempty"` // RAG sources emitted in ragSourcesEvent for this answer
+	DurationMs     int64              `json:"durationMs,omitempty"`
+	RunesPerSecond float64            `json:"runesPerSecond,omitempty"`
+	Error          string             `json:"error,omitempty"`
+	Cancelled      bool               `json:"cancelled,omitempty"` // The answer was stopped and is partial
+	Model          string             `json:"model,omitempty"`     // Chat model that wrote the answer
+	Options        *GenerationOptions `json:"options,omitempty"`   // Generation options the answer was produced with, for audit
+	CreatedAt      time.Time          `json:"createdAt"`
+}
+
+// Session is the saved form of a conversation.
+type Session struct {
+	ID        string           `json:"id"`
+	Title     string           `json:"title"`
+	CreatedAt time.Time        `json:"createdAt"`
+	UpdatedAt time.Time        `json:"updatedAt"`
+	Template  string           `json:"template,omitempty"` // Prompt template chosen for this conversation; empty uses the default
+	Messages  []SessionMessage `json:"messages"`           // Alternating user and assistant messages, oldest first
+}
+
+// Conversation holds the message history of one chat and persists it as a session.
+type Conversation struct {
+	Session
+	path   string     // Session file; empty means memory only
+	mu     sync.Mutex // Protects Session and path
+	turnMu sync.Mutex // Held while a message is answered, so turns are answered in order
+}
+
+// newID returns a random identifier for conversations and requests.
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// estimateTokens approximates the number of tokens in text.
+func estimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + approxCharsPerToken - 1) / approxCharsPerToken
+}
+
+// NewConversation is a Wails-bindable method that starts an empty conversation and
+// returns its ID, to be passed to HandleMessage. The session is saved once it has a
+// first answer.
+func (a *App) NewConversation() string {
+	a.convMu.Lock()
+	defer a.convMu.Unlock()
+	conv := a.newConversationLocked(newID())
+	log.Printf("Started conversation %s", conv.ID)
+	return conv.ID
+}
+
+// newConversationLocked registers an empty conversation. The caller must hold a.convMu.
+func (a *App) newConversationLocked(id string) *Conversation {
+	now := time.Now()
+	conv := &Conversation{Session: Session{ID: id, CreatedAt: now, UpdatedAt: now}}
+	conv.path = sessionPath(a.sessionsDir, id)
+	a.conversations[id] = conv
+	return conv
+}
+
+// conversation returns the conversation with the given ID, creating it if needed.
+// An empty ID selects a shared default conversation.
+func (a *App) conversation(id string) *Conversation {
+	if id == "" {
+		id = defaultConversationID
+	}
+	a.convMu.Lock()
+	defer a.convMu.Unlock()
+	conv, ok := a.conversations[id]
+	if !ok {
+		conv = a.newConversationLocked(id)
+	}
+	return conv
+}
+
+// History returns the most recent turns of the conversation that fit in tokenBudget.
+// Whole user/assistant pairs are dropped from the oldest end so the model never sees
+// an answer without its question.
+func (c *Conversation) History(tokenBudget int) []OllamaChatMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	messages := make([]OllamaChatMessage, 0, len(c.Messages))
+	for _, msg := range c.Messages {
+		if msg.Role == "assistant" && msg.Content == "" {
+			// A failed answer: drop it together with its question.
+			if n := len(messages); n > 0 && messages[n-1].Role == "user" {
+				messages = messages[:n-1]
+			}
+			continue
+		}
+		messages = append(messages, OllamaChatMessage{Role: msg.Role, Content: msg.Content})
+	}
+	return trimHistory(messages, tokenBudget)
+}
+
+// TemplateName returns the prompt template chosen for the conversation, if any.
+func (c *Conversation) TemplateName() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Template
+}
+
+// AddTurn appends a completed question and answer to the conversation and saves it.
+// The first question becomes the session title unless it was renamed already.
+func (c *Conversation) AddTurn(question string, answer SessionMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	answer.Role = "assistant"
+	answer.CreatedAt = now
+	c.Messages = append(c.Messages, SessionMessage{Role: "user", Content: question, CreatedAt: now}, answer)
+	c.UpdatedAt = now
+	if c.Title == "" {
+		c.Title = sessionTitle(question)
+	}
+	if err := c.saveLocked(); err != nil {
+		log.Printf("Error saving session %s: %v", c.ID, err)
+	}
+}
+
+// trimHistory returns the longest suffix of messages, starting at a user message,
+// whose estimated size fits in tokenBudget.
+func trimHistory(messages []OllamaChatMessage, tokenBudget int) []OllamaChatMessage {
+	used := 0
+	start := len(messages)
+	for i := len(messages) - 1; i >= 0; i-- {
+		used += estimateTokens(messages[i].Content)
+		if used > tokenBudget {
+			break
+		}
+		if messages[i].Role == "user" {
+			start = i
+		}
+	}
+	if start < len(messages) {
+		log.Printf("Using %d of %d history messages within a budget of %d tokens.", len(messages)-start, len(messages), tokenBudget)
+	}
+	trimmed := make([]OllamaChatMessage, len(messages)-start)
+	copy(trimmed, messages[start:])
+	return trimmed
+}
+
+// standaloneQuery rewrites a follow-up question into one that can be embedded without
+// the conversation, so retrieval works for questions like "what about his potassium?".
+// Without history, or if the rewrite fails, the question is returned unchanged. The
+// rewrite is part of gen, so it uses its model and seed and is stopped with it.
+func (a *App) standaloneQuery(gen *generation, history []OllamaChatMessage, question string) string {
+	if len(history) == 0 {
+		return question
+	}
+
+	var transcript strings.Builder
+	for _, msg := range history {
+		transcript.WriteString(fmt.Sprintf("%s: %s\n", msg.Role, msg.Content))
+	}
+	prompt := fmt.Sprintf(standaloneQueryPrompt, transcript.String(), question)
+
+	rewritten, err := a.ollamaChatComplete(gen, []OllamaChatMessage{{Role: "user", Content: prompt}}, standaloneQueryMaxTokens)
+	if err != nil {
+		log.Printf("Error rewriting follow-up question: %v. Using it unchanged for retrieval.", err)
+		return question
+	}
+	rewritten = strings.TrimSpace(strings.Trim(strings.TrimSpace(rewritten), `"`))
+	if rewritten == "" {
+		return question
+	}
+	log.Printf("Rewrote follow-up question %q as standalone query %q", question, rewritten)
+	return rewritten
+}
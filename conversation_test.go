@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestApp returns an App whose Ollama requests go to handler.
+func newTestApp(t *testing.T, handler http.HandlerFunc) *App {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	a := NewApp()
+	a.ctx = context.Background()
+	a.settings.OllamaURL = server.URL
+	return a
+}
+
+func TestStandaloneQueryUsesGenerationOptions(t *testing.T) {
+	requests := make(chan OllamaChatRequest, 1)
+	a := newTestApp(t, func(w http.ResponseWriter, r *http.Request) {
+		var req OllamaChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("could not decode request: %v", err)
+		}
+		requests <- req
+		json.NewEncoder(w).Encode(OllamaChatResponse{Message: OllamaChatMessage{Role: "assistant", Content: "What is John's potassium level?"}})
+	})
+
+	temperature, seed, numPredict := 0.8, 42, 512
+	gen := a.startGeneration("c", "request-model", GenerationOptions{
+		Temperature: &temperature,
+		Seed:        &seed,
+		NumPredict:  &numPredict,
+		Stop:        []string{"\n"},
+	})
+	defer a.finishGeneration(gen.requestID)
+
+	history := []OllamaChatMessage{{Role: "user", Content: "How is John's kidney function?"}, {Role: "assistant", Content: "Normal."}}
+	if got := a.standaloneQuery(gen, history, "what about his potassium?"); got != "What is John's potassium level?" {
+		t.Errorf("standaloneQuery() = %q", got)
+	}
+
+	req := <-requests
+	if req.Model != "request-model" {
+		t.Errorf("model = %q, want the generation's model", req.Model)
+	}
+	opts := req.Options
+	if opts == nil || opts.Temperature == nil || *opts.Temperature != 0 {
+		t.Fatalf("options = %+v, want temperature 0", opts)
+	}
+	if opts.Seed == nil || *opts.Seed != seed {
+		t.Errorf("seed = %v, want %d", opts.Seed, seed)
+	}
+	if opts.NumPredict == nil || *opts.NumPredict != standaloneQueryMaxTokens {
+		t.Errorf("num_predict = %v, want %d", opts.NumPredict, standaloneQueryMaxTokens)
+	}
+	if len(opts.Stop) != 0 {
+		t.Errorf("stop = %q, want the user's stop sequences left out", opts.Stop)
+	}
+}
+
+func TestStandaloneQueryStopsWithGeneration(t *testing.T) {
+	a := newTestApp(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done() // Never answers
+	})
+	gen := a.startGeneration("c", "model", GenerationOptions{})
+	defer a.finishGeneration(gen.requestID)
+
+	done := make(chan string)
+	go func() {
+		done <- a.standaloneQuery(gen, []OllamaChatMessage{{Role: "user", Content: "hi"}}, "and then?")
+	}()
+	gen.cancel()
+	select {
+	case got := <-done:
+		if got != "and then?" {
+			t.Errorf("standaloneQuery() = %q, want the question unchanged", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("standaloneQuery did not return after the generation was stopped")
+	}
+}
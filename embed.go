@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultEmbedBatchSize   = 16                     // Chunks sent per /api/embed request
+	defaultEmbedConcurrency = 4                      // Parallel /api/embed requests during a load
+	maxEmbedBatchSize       = 256                    // Upper bound accepted by LoadOptions validation
+	maxEmbedConcurrency     = 32                     // Upper bound accepted by LoadOptions validation
+	embedMaxRetries         = 3                      // Retries of a batch after a transient failure
+	embedInitialBackoff     = 500 * time.Millisecond // Delay before the first retry; doubled on each retry
+)
+
+// OllamaEmbedRequest defines the structure for the Ollama batch embedding request (/api/embed)
+type OllamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// OllamaEmbedResponse defines the structure for the Ollama batch embedding response (/api/embed)
+type OllamaEmbedResponse struct {
+	Model      string      `json:"model"`
+	Embeddings [][]float64 `json:"embeddings"`
+}
+
+// embedAPIError is a non-200 response from the embedding API.
+type embedAPIError struct {
+	Status     string
+	StatusCode int
+	Body       string
+}
+
+func (e *embedAPIError) Error() string {
+	return fmt.Sprintf("ollama embed API error (%s): %s", e.Status, e.Body)
+}
+
+// isTransientEmbedError reports whether a failed embedding request is worth retrying:
+// connection problems, rate limiting and server errors are, bad requests are not.
+func isTransientEmbedError(err error) bool {
+	var apiErr *embedAPIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// getOllamaEmbeddings calls Ollama's batch /api/embed endpoint for several texts at once.
+// The returned embeddings are in the same order as texts.
+func (a *App) getOllamaEmbeddings(ctx context.Context, texts []string) ([][]float64, error) {
+	jsonBody, err := json.Marshal(OllamaEmbedRequest{
+		Model: a.currentSettings().EmbeddingModel,
+		Input: texts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not process embed request (marshal): %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.ollamaURL("embed"), bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("could not create embed request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to Ollama service for embeddings: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		responseBodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, &embedAPIError{Status: resp.Status, StatusCode: resp.StatusCode, Body: string(responseBodyBytes)}
+	}
+
+	var embedResp OllamaEmbedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embedResp); err != nil {
+		return nil, fmt.Errorf("could not parse Ollama embed response: %w", err)
+	}
+	if len(embedResp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("ollama returned %d embeddings for %d inputs", len(embedResp.Embeddings), len(texts))
+	}
+	for i, embedding := range embedResp.Embeddings {
+		if len(embedding) == 0 {
+			return nil, fmt.Errorf("received empty embedding from Ollama for input %d", i)
+		}
+	}
+	return embedResp.Embeddings, nil
+}
+
+// getOllamaEmbeddingsWithRetry is getOllamaEmbeddings with exponential backoff on
+// transient failures.
+func (a *App) getOllamaEmbeddingsWithRetry(ctx context.Context, texts []string) ([][]float64, error) {
+	backoff := embedInitialBackoff
+	for attempt := 0; ; attempt++ {
+		embeddings, err := a.getOllamaEmbeddings(ctx, texts)
+		if err == nil || attempt >= embedMaxRetries || ctx.Err() != nil || !isTransientEmbedError(err) {
+			return embeddings, err
+		}
+		log.Printf("Embedding batch of %d failed (attempt %d/%d): %v. Retrying in %s.", len(texts), attempt+1, embedMaxRetries+1, err, backoff)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// embedBatchResult is the outcome of one batch of embedConcurrently.
+type embedBatchResult struct {
+	start      int // Index in texts of the first input of the batch
+	count      int
+	embeddings [][]float64
+	err        error
+}
+
+// embedConcurrently embeds texts in batches of batchSize with up to concurrency requests
+// in flight. onBatch is called on the calling goroutine for every batch as it finishes,
+// so callers can update state without locking; batches may finish out of order, but
+// each result carries its position in texts. Once ctx is cancelled no new batches are
+// started and the remaining ones are reported with ctx.Err().
+func (a *App) embedConcurrently(ctx context.Context, texts []string, batchSize, concurrency int, onBatch func(embedBatchResult)) {
+	if batchSize < 1 {
+		batchSize = defaultEmbedBatchSize
+	}
+	if concurrency < 1 {
+		concurrency = defaultEmbedConcurrency
+	}
+
+	batches := make(chan embedBatchResult)
+	results := make(chan embedBatchResult)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				if err := ctx.Err(); err != nil {
+					batch.err = err
+				} else {
+					batch.embeddings, batch.err = a.getOllamaEmbeddingsWithRetry(ctx, texts[batch.start:batch.start+batch.count])
+				}
+				results <- batch
+			}
+		}()
+	}
+	go func() {
+		for start := 0; start < len(texts); start += batchSize {
+			batches <- embedBatchResult{start: start, count: min(batchSize, len(texts)-start)}
+		}
+		close(batches)
+		wg.Wait()
+		close(results)
+	}()
+
+	for result := range results {
+		onBatch(result)
+	}
+}
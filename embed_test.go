@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// embedHandler answers /api/embed with the number in each input text, as "text N",
+// as the first component of its embedding. Inputs containing fail get a server error
+// the first failures times.
+type embedHandler struct {
+	mu       sync.Mutex
+	batches  []int // Size of every request, including failed ones
+	fail     string
+	failures int
+	status   int // Status of the failed requests
+}
+
+func (h *embedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req OllamaEmbedRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	h.mu.Lock()
+	h.batches = append(h.batches, len(req.Input))
+	failing := h.fail != "" && h.failures > 0 && slices.Contains(req.Input, h.fail)
+	if failing {
+		h.failures--
+	}
+	h.mu.Unlock()
+	if failing {
+		http.Error(w, "model crashed", h.status)
+		return
+	}
+
+	resp := OllamaEmbedResponse{Model: req.Model}
+	for _, text := range req.Input {
+		n, _ := strconv.Atoi(strings.TrimPrefix(text, "text "))
+		resp.Embeddings = append(resp.Embeddings, []float64{float64(n), 1})
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestEmbedConcurrently(t *testing.T) {
+	texts := make([]string, 10)
+	for i := range texts {
+		texts[i] = "text " + strconv.Itoa(i)
+	}
+	tests := []struct {
+		name        string
+		status      int
+		failures    int
+		wantBatches []int // Sorted request sizes
+		wantErr     bool  // The batch of "text 4" fails
+	}{
+		{"batches", 0, 0, []int{1, 3, 3, 3}, false},
+		{"retried server error", http.StatusInternalServerError, 1, []int{1, 3, 3, 3, 3}, false},
+		{"bad request not retried", http.StatusBadRequest, 1, []int{1, 3, 3, 3}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &embedHandler{fail: "text 4", failures: tt.failures, status: tt.status}
+			a := newTestApp(t, handler.ServeHTTP)
+
+			embeddings := make([][]float64, len(texts))
+			var failed []int
+			a.embedConcurrently(context.Background(), texts, 3, 2, func(result embedBatchResult) {
+				if result.err != nil {
+					failed = append(failed, result.start)
+					return
+				}
+				if len(result.embeddings) != result.count {
+					t.Errorf("batch at %d has %d embeddings, want %d", result.start, len(result.embeddings), result.count)
+				}
+				copy(embeddings[result.start:], result.embeddings)
+			})
+
+			slices.Sort(handler.batches)
+			if !slices.Equal(handler.batches, tt.wantBatches) {
+				t.Errorf("request sizes = %v, want %v", handler.batches, tt.wantBatches)
+			}
+			if tt.wantErr != (len(failed) > 0) || (tt.wantErr && !slices.Equal(failed, []int{3})) {
+				t.Fatalf("failed batches start at %v, want the batch of text 4 to fail: %t", failed, tt.wantErr)
+			}
+			// Every embedding belongs to its own text, whatever order the batches finished in
+			for i, embedding := range embeddings {
+				if tt.wantErr && i >= 3 && i < 6 {
+					continue
+				}
+				if len(embedding) == 0 || embedding[0] != float64(i) {
+					t.Errorf("embedding %d = %v, want the one of %q", i, embedding, texts[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEmbedConcurrentlyStopsWhenCancelled(t *testing.T) {
+	handler := &embedHandler{}
+	a := newTestApp(t, handler.ServeHTTP)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	reported := 0
+	a.embedConcurrently(ctx, []string{"text 0", "text 1", "text 2"}, 1, 1, func(result embedBatchResult) {
+		reported++
+		if result.err != context.Canceled {
+			t.Errorf("batch at %d error = %v, want context.Canceled", result.start, result.err)
+		}
+	})
+	if reported != 3 || len(handler.batches) != 0 {
+		t.Errorf("%d batches reported and %d requested, want 3 reported and none requested", reported, len(handler.batches))
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxZipEntryBytes bounds the uncompressed size of an XML part read from a DOCX or ODT
+// file. Text parts are far smaller; images are separate members that are never read.
+const maxZipEntryBytes = 64 << 20
+
+func init() {
+	registerExtractor(docxExtractor{})
+}
+
+// docxExtractor extracts text from Word .docx documents.
+type docxExtractor struct{}
+
+func (docxExtractor) Name() string         { return "docx" }
+func (docxExtractor) Extensions() []string { return []string{".docx"} }
+func (docxExtractor) MIMETypes() []string {
+	return []string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"}
+}
+
+// Extract returns the document text and the title, author and creation date from
+// docProps/core.xml. Missing document properties are not an error.
+func (docxExtractor) Extract(content []byte) (ExtractedDocument, error) {
+	text, err := extractDOCXText(content)
+	if err != nil {
+		return ExtractedDocument{}, err
+	}
+	doc := ExtractedDocument{Pages: []pageText{{Text: text}}}
+	if coreXML, err := readZipEntry(content, "docProps/core.xml"); err == nil {
+		fields := xmlTextFields(coreXML, "title", "creator", "created")
+		doc.Metadata = DocumentMetadata{
+			Title:  fields["title"],
+			Author: fields["creator"],
+			Date:   fields["created"],
+		}
+	}
+	return doc, nil
+}
+
+// readZipEntry returns the content of the named member of a zip archive.
+// DOCX and ODT files are both zip containers around XML parts. A member larger than
+// maxZipEntryBytes is an error, so a small file cannot expand into gigabytes of memory.
+func readZipEntry(content []byte, name string) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("could not open zip container: %w", err)
+	}
+	for _, file := range archive.File {
+		if file.Name != name {
+			continue
+		}
+		if file.UncompressedSize64 > maxZipEntryBytes {
+			return nil, fmt.Errorf("%s is larger than %d MB uncompressed", name, maxZipEntryBytes>>20)
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("could not open %s: %w", name, err)
+		}
+		defer rc.Close()
+		// The declared size can lie, so the read itself is limited too
+		data, err := io.ReadAll(io.LimitReader(rc, maxZipEntryBytes+1))
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", name, err)
+		}
+		if len(data) > maxZipEntryBytes {
+			return nil, fmt.Errorf("%s is larger than %d MB uncompressed", name, maxZipEntryBytes>>20)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("%s not found in container", name)
+}
+
+// paragraphWriter collects paragraphs and headings and joins them with blank lines,
+// which is the first separator chunkTextRecursive splits on.
+type paragraphWriter struct {
+	paragraphs []string
+	current    strings.Builder
+	heading    int // Outline level of the paragraph being written; 0 for body text
+}
+
+// startParagraph begins a new paragraph, flushing any pending text.
+func (w *paragraphWriter) startParagraph(headingLevel int) {
+	w.endParagraph()
+	w.heading = headingLevel
+}
+
+// endParagraph finishes the current paragraph. Headings are written as Markdown
+// headings so their boundary survives chunking and is visible to the model.
+func (w *paragraphWriter) endParagraph() {
+	text := strings.TrimSpace(w.current.String())
+	w.current.Reset()
+	if text != "" {
+		if w.heading > 0 {
+			text = strings.Repeat("#", min(w.heading, 6)) + " " + text
+		}
+		w.paragraphs = append(w.paragraphs, text)
+	}
+	w.heading = 0
+}
+
+// WriteString appends text to the current paragraph.
+func (w *paragraphWriter) WriteString(s string) {
+	w.current.WriteString(s)
+}
+
+// String returns all paragraphs separated by blank lines.
+func (w *paragraphWriter) String() string {
+	w.endParagraph()
+	return strings.Join(w.paragraphs, "\n\n")
+}
+
+// docxHeadingLevel returns the outline level implied by a Word paragraph style,
+// e.g. "Heading2" -> 2 and "Title" -> 1, or 0 for body styles.
+func docxHeadingLevel(style string) int {
+	lower := strings.ToLower(style)
+	if lower == "title" {
+		return 1
+	}
+	if strings.HasPrefix(lower, "heading") {
+		if level, err := strconv.Atoi(strings.TrimPrefix(lower, "heading")); err == nil && level > 0 {
+			return level
+		}
+	}
+	return 0
+}
+
+// extractDOCXText extracts the text of a Word .docx document, keeping paragraph
+// and heading boundaries.
+func extractDOCXText(content []byte) (string, error) {
+	documentXML, err := readZipEntry(content, "word/document.xml")
+	if err != nil {
+		return "", err
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(documentXML))
+	var out paragraphWriter
+	inText := false
+	runDepth := 0 // Tabs also appear in paragraph properties as tab stops; only those in a run are text
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("could not parse word/document.xml: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				out.startParagraph(0)
+			case "pStyle":
+				out.heading = docxHeadingLevel(xmlAttr(t, "val"))
+			case "outlineLvl":
+				if level, err := strconv.Atoi(xmlAttr(t, "val")); err == nil && out.heading == 0 {
+					out.heading = level + 1 // outlineLvl is 0-based
+				}
+			case "r":
+				runDepth++
+			case "t":
+				inText = true
+			case "tab":
+				if runDepth > 0 {
+					out.WriteString("\t")
+				}
+			case "br", "cr":
+				out.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "p":
+				out.endParagraph()
+			case "r":
+				runDepth--
+			case "t":
+				inText = false
+			}
+		case xml.CharData:
+			if inText {
+				out.WriteString(string(t))
+			}
+		}
+	}
+	return out.String(), nil
+}
+
+// xmlAttr returns the value of the attribute with the given local name, ignoring its namespace.
+func xmlAttr(element xml.StartElement, local string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// xmlTextFields returns the trimmed text of the first element with each of the given
+// local names, ignoring namespaces. Unparseable XML yields whatever was found so far.
+func xmlTextFields(data []byte, locals ...string) map[string]string {
+	wanted := make(map[string]bool, len(locals))
+	for _, local := range locals {
+		wanted[local] = true
+	}
+	fields := make(map[string]string, len(locals))
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	current := ""
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return fields
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if _, done := fields[t.Name.Local]; wanted[t.Name.Local] && !done {
+				current = t.Name.Local
+			}
+		case xml.EndElement:
+			current = ""
+		case xml.CharData:
+			if current != "" {
+				if text := strings.TrimSpace(string(t)); text != "" {
+					fields[current] = text
+				}
+			}
+		}
+	}
+}
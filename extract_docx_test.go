@@ -0,0 +1,97 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"strings"
+	"testing"
+)
+
+// zipArchive returns a zip archive holding the given members.
+func zipArchive(t *testing.T, members map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, data := range members {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractDOCXText(t *testing.T) {
+	const w = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"`
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"paragraphs", `<w:p><w:r><w:t>First</w:t></w:r></w:p><w:p><w:r><w:t>Second</w:t></w:r></w:p>`, "First\n\nSecond"},
+		{"heading", `<w:p><w:pPr><w:pStyle w:val="Heading2"/></w:pPr><w:r><w:t>Findings</w:t></w:r></w:p>`, "## Findings"},
+		{"tab in a run", `<w:p><w:r><w:t>LVEF</w:t><w:tab/><w:t>55%</w:t></w:r></w:p>`, "LVEF\t55%"},
+		{"tab stops", `<w:p><w:pPr><w:tabs><w:tab w:val="left" w:pos="2880"/></w:tabs></w:pPr><w:r><w:t>LVEF 55%</w:t></w:r></w:p>`, "LVEF 55%"},
+		{"line break", `<w:p><w:r><w:t>Line one</w:t><w:br/><w:t>Line two</w:t></w:r></w:p>`, "Line one\nLine two"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := zipArchive(t, map[string][]byte{
+				"word/document.xml": []byte(`<w:document ` + w + `><w:body>` + tt.body + `</w:body></w:document>`),
+			})
+			got, err := extractDOCXText(content)
+			if err != nil {
+				t.Fatalf("extractDOCXText() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("extractDOCXText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadZipEntryLimitsSize(t *testing.T) {
+	large := make([]byte, maxZipEntryBytes+1)
+
+	// A member whose header understates its size is stopped while reading, by the
+	// limit or by archive/zip noticing the size mismatch
+	var compressed bytes.Buffer
+	fw, _ := flate.NewWriter(&compressed, flate.BestSpeed)
+	fw.Write(large)
+	fw.Close()
+	var lying bytes.Buffer
+	w := zip.NewWriter(&lying)
+	raw, err := w.CreateRaw(&zip.FileHeader{Name: "content.xml", Method: zip.Deflate, CompressedSize64: uint64(compressed.Len()), UncompressedSize64: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw.Write(compressed.Bytes())
+	w.Close()
+
+	tests := []struct {
+		name    string
+		content []byte
+		wantErr string
+	}{
+		{"declared size", zipArchive(t, map[string][]byte{"content.xml": large}), "larger than"},
+		{"understated size", lying.Bytes(), "could not read"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readZipEntry(tt.content, "content.xml")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("readZipEntry() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+	if data, err := readZipEntry(zipArchive(t, map[string][]byte{"content.xml": []byte("<text/>")}), "content.xml"); err != nil || string(data) != "<text/>" {
+		t.Errorf("readZipEntry() of a small member = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerExtractor(odtExtractor{})
+}
+
+// odtExtractor extracts text from OpenDocument .odt files.
+type odtExtractor struct{}
+
+func (odtExtractor) Name() string         { return "odt" }
+func (odtExtractor) Extensions() []string { return []string{".odt"} }
+func (odtExtractor) MIMETypes() []string  { return []string{"application/vnd.oasis.opendocument.text"} }
+
+// Extract returns the document text and the title, author and creation date from
+// meta.xml. Missing metadata is not an error.
+func (odtExtractor) Extract(content []byte) (ExtractedDocument, error) {
+	text, err := extractODTText(content)
+	if err != nil {
+		return ExtractedDocument{}, err
+	}
+	doc := ExtractedDocument{Pages: []pageText{{Text: text}}}
+	if metaXML, err := readZipEntry(content, "meta.xml"); err == nil {
+		fields := xmlTextFields(metaXML, "title", "initial-creator", "creator", "creation-date")
+		doc.Metadata = DocumentMetadata{
+			Title:  fields["title"],
+			Author: fields["initial-creator"],
+			Date:   fields["creation-date"],
+		}
+		if doc.Metadata.Author == "" {
+			doc.Metadata.Author = fields["creator"]
+		}
+	}
+	return doc, nil
+}
+
+// extractODTText extracts the text of an OpenDocument .odt file, keeping paragraph
+// and heading boundaries.
+func extractODTText(content []byte) (string, error) {
+	contentXML, err := readZipEntry(content, "content.xml")
+	if err != nil {
+		return "", err
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(contentXML))
+	var out paragraphWriter
+	depth := 0 // Nesting depth of text:p / text:h elements, as notes can contain paragraphs
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("could not parse content.xml: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "h":
+				level, err := strconv.Atoi(xmlAttr(t, "outline-level"))
+				if err != nil || level < 1 {
+					level = 1
+				}
+				out.startParagraph(level)
+				depth++
+			case "p":
+				out.startParagraph(0)
+				depth++
+			case "s":
+				// text:s collapses runs of spaces; text:c holds the count.
+				count, err := strconv.Atoi(xmlAttr(t, "c"))
+				if err != nil || count < 1 {
+					count = 1
+				}
+				out.WriteString(strings.Repeat(" ", count))
+			case "tab":
+				out.WriteString("\t")
+			case "line-break":
+				out.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "h", "p":
+				out.endParagraph()
+				depth--
+			}
+		case xml.CharData:
+			if depth > 0 {
+				out.WriteString(string(t))
+			}
+		}
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ledongthuc/pdf"
+)
+
+func init() {
+	registerExtractor(pdfExtractor{})
+}
+
+// pdfExtractor extracts text page by page from PDF documents.
+type pdfExtractor struct{}
+
+func (pdfExtractor) Name() string         { return "pdf" }
+func (pdfExtractor) Extensions() []string { return []string{".pdf"} }
+func (pdfExtractor) MIMETypes() []string  { return []string{"application/pdf"} }
+
+// Extract extracts the plain text of every page of a PDF document and the title,
+// author and creation date from its Info dictionary.
+// Pages without extractable text (e.g. scanned images) are skipped.
+func (pdfExtractor) Extract(content []byte) (doc ExtractedDocument, err error) {
+	// The PDF parser panics on some malformed files; report those as errors instead.
+	defer func() {
+		if r := recover(); r != nil {
+			doc = ExtractedDocument{}
+			err = fmt.Errorf("malformed PDF: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return ExtractedDocument{}, fmt.Errorf("could not open PDF: %w", err)
+	}
+
+	numPages := reader.NumPage()
+	info := reader.Trailer().Key("Info")
+	doc.Metadata = DocumentMetadata{
+		Title:     strings.TrimSpace(info.Key("Title").Text()),
+		Author:    strings.TrimSpace(info.Key("Author").Text()),
+		Date:      parsePDFDate(info.Key("CreationDate").Text()),
+		PageCount: numPages,
+	}
+
+	fonts := make(map[string]*pdf.Font) // Shared font cache across pages
+	for pageNum := 1; pageNum <= numPages; pageNum++ {
+		page := reader.Page(pageNum)
+		if page.V.IsNull() {
+			continue
+		}
+		text, err := page.GetPlainText(fonts)
+		if err != nil {
+			log.Printf("Error extracting text from PDF page %d: %v. Skipping page.", pageNum, err)
+			continue
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		doc.Pages = append(doc.Pages, pageText{Page: pageNum, Text: text})
+	}
+
+	if len(doc.Pages) == 0 && numPages > 0 {
+		return ExtractedDocument{}, fmt.Errorf("no extractable text in %d pages (scanned document?)", numPages)
+	}
+	return doc, nil
+}
+
+// parsePDFDate converts a PDF date string such as "D:20240131093000+01'00'" to RFC 3339.
+// Unparseable dates are returned unchanged.
+func parsePDFDate(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+	normalized := strings.TrimPrefix(value, "D:")
+	normalized = strings.ReplaceAll(normalized, "'", "")
+	for _, layout := range []string{"20060102150405-0700", "20060102150405Z", "20060102150405", "20060102"} {
+		if t, err := time.Parse(layout, normalized); err == nil {
+			return t.Format(time.RFC3339)
+		}
+	}
+	return value
+}
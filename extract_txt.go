@@ -0,0 +1,18 @@
+package main
+
+func init() {
+	registerExtractor(txtExtractor{})
+}
+
+// txtExtractor handles plain text files. It is also used for files with an unknown
+// extension whose content sniffs as text/plain.
+type txtExtractor struct{}
+
+func (txtExtractor) Name() string         { return "text" }
+func (txtExtractor) Extensions() []string { return []string{".txt"} }
+func (txtExtractor) MIMETypes() []string  { return []string{"text/plain"} }
+
+// Extract returns the file content as a single page.
+func (txtExtractor) Extract(content []byte) (ExtractedDocument, error) {
+	return ExtractedDocument{Pages: []pageText{{Text: string(content)}}}, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// errUnsupportedFormat is returned when no registered extractor handles a file.
+var errUnsupportedFormat = errors.New("unsupported format")
+
+// pageText is the text of one page of a document.
+type pageText struct {
+	Page int // 1-based page number; 0 for formats without pages
+	Text string
+}
+
+// DocumentMetadata holds structured metadata an extractor found in a document.
+type DocumentMetadata struct {
+	Title     string `json:"title,omitempty"`
+	Author    string `json:"author,omitempty"`
+	Date      string `json:"date,omitempty"`      // Creation date as found in the document, ideally RFC 3339
+	PageCount int    `json:"pageCount,omitempty"` // Number of pages for paginated formats
+}
+
+// ExtractedDocument is the text and metadata an Extractor produced for one file.
+type ExtractedDocument struct {
+	Pages    []pageText // Text per page; a single entry with Page 0 for formats without pages
+	Metadata DocumentMetadata
+}
+
+// Extractor turns the raw content of one document format into text.
+// Each format lives in its own extract_<format>.go file and registers itself
+// with registerExtractor from an init function.
+type Extractor interface {
+	// Name identifies the extractor in logs and load summaries.
+	Name() string
+	// Extensions lists the lower-case file extensions handled, including the dot.
+	Extensions() []string
+	// MIMETypes lists the sniffed content types handled, as returned by sniffMIMEType.
+	MIMETypes() []string
+	// Extract returns the text and metadata of a document.
+	Extract(content []byte) (ExtractedDocument, error)
+}
+
+var (
+	extractorsMu     sync.RWMutex
+	extractorsByExt  = make(map[string]Extractor)
+	extractorsByMIME = make(map[string]Extractor)
+)
+
+// registerExtractor makes an extractor available to the loader. Registering a second
+// extractor for the same extension or MIME type replaces the first one.
+func registerExtractor(extractor Extractor) {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+	for _, ext := range extractor.Extensions() {
+		extractorsByExt[strings.ToLower(ext)] = extractor
+	}
+	for _, mimeType := range extractor.MIMETypes() {
+		extractorsByMIME[mimeType] = extractor
+	}
+}
+
+// supportedIncludePatterns returns an include pattern such as "*.pdf" for each
+// extension handled by a registered extractor, sorted. The loader picks up these files
+// by default; other files are only offered to the registry (and sniffed, then reported
+// as skipped if unsupported) when the user's include patterns select them.
+func supportedIncludePatterns() []string {
+	extractorsMu.RLock()
+	defer extractorsMu.RUnlock()
+	patterns := make([]string, 0, len(extractorsByExt))
+	for ext := range extractorsByExt {
+		patterns = append(patterns, "*"+ext)
+	}
+	slices.Sort(patterns)
+	return patterns
+}
+
+// extractorFor picks the extractor for a file, first by extension and then by
+// sniffing its content type. It returns an error wrapping errUnsupportedFormat
+// with the reason when no extractor matches.
+func extractorFor(filePath string, content []byte) (Extractor, error) {
+	extractorsMu.RLock()
+	defer extractorsMu.RUnlock()
+
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if extractor, ok := extractorsByExt[ext]; ok {
+		return extractor, nil
+	}
+	mimeType := sniffMIMEType(content)
+	if extractor, ok := extractorsByMIME[mimeType]; ok {
+		log.Printf("No extractor for extension %q of %s; using %s based on sniffed type %s.", ext, filePath, extractor.Name(), mimeType)
+		return extractor, nil
+	}
+	if ext == "" {
+		return nil, fmt.Errorf("%w: no extension and content type %s", errUnsupportedFormat, mimeType)
+	}
+	return nil, fmt.Errorf("%w: no extractor for %s files (content type %s)", errUnsupportedFormat, ext, mimeType)
+}
+
+// sniffMIMEType detects the content type of a document. Zip containers are looked
+// into, since DOCX and ODT files are both plain zip archives to http.DetectContentType.
+func sniffMIMEType(content []byte) string {
+	mimeType := http.DetectContentType(content)
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = mimeType[:i] // Drop parameters such as charset
+	}
+	if mimeType != "application/zip" {
+		return mimeType
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return mimeType
+	}
+	for _, file := range archive.File {
+		switch file.Name {
+		case "mimetype": // OpenDocument stores its type in an uncompressed first entry
+			rc, err := file.Open()
+			if err != nil {
+				continue
+			}
+			data, err := io.ReadAll(io.LimitReader(rc, 256))
+			rc.Close()
+			if err == nil {
+				return strings.TrimSpace(string(data))
+			}
+		case "word/document.xml":
+			return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+		}
+	}
+	return mimeType
+}
+
+// extractDocument runs the matching extractor on a file.
+func extractDocument(filePath string, content []byte) (ExtractedDocument, error) {
+	extractor, err := extractorFor(filePath, content)
+	if err != nil {
+		return ExtractedDocument{}, err
+	}
+	doc, err := extractor.Extract(content)
+	if err != nil {
+		return ExtractedDocument{}, fmt.Errorf("%s extractor: %w", extractor.Name(), err)
+	}
+	return doc, nil
+}
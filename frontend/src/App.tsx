@@ -2,7 +2,18 @@ import { useEffect, useRef, useState } from "react";
 import ReactMarkdown from "react-markdown";
 import remarkGfm from "remark-gfm";
 import "./App.css";
-import { HandleMessage, LoadPersonalData } from "../wailsjs/go/main/App";
+import {
+  CancelLoad,
+  GetBackendStatus,
+  GetSettings,
+  HandleMessage,
+  HandleMessageWithFilter,
+  LoadPersonalData,
+  NewConversation,
+  PullModel,
+  SetConversationTemplate,
+  StopGeneration,
+} from "../wailsjs/go/main/App";
 import { EventsOn } from "../wailsjs/runtime"; // Corrected import path for EventsOn
 
 interface Message {
@@ -12,34 +23,157 @@ interface Message {
   durationMs?: number;
   runesPerSecond?: number;
   isError?: boolean;
+  isCancelled?: boolean; // The answer was stopped before it finished
   sources?: SourceInfo[]; // Added to store sources directly with the AI message
 }
 
 // Define the structure of the event payload from Go
 interface OllamaStreamEventPayload {
+  requestId: string; // HandleMessage call the event belongs to
+  conversationId: string;
+  queued?: boolean; // The request waits for a free generation slot
   content?: string; // content can be empty, especially in the final 'done' message
   done: boolean;
   error?: string;
   durationMs?: number;
   runesPerSecond?: number;
+  cancelled?: boolean; // Set on the final event when StopGeneration aborted the answer
 }
 
 // Define the SourceInfo interface to match the Go struct
 interface SourceInfo {
   fileName: string;
+  page?: number; // 1-based page for paginated documents such as PDFs
   chunkId: number;
   score: number;
+  vectorScore?: number; // Embedding part of score in hybrid retrieval
+  keywordScore?: number; // Keyword (BM25) part of score in hybrid retrieval
+  rerankScore?: number; // Relevance rated by the re-ranking model, 0 to 1
+  sent: boolean; // The chunk was part of the prompt
+  skipReason?: string; // Why a retrieved chunk was not sent
 }
 
+// Define the structure of the ragSourcesEvent payload from Go
+interface RagSourcesEventPayload {
+  requestId: string;
+  conversationId: string;
+  sources: SourceInfo[];
+}
+
+// Define the structure of the contextBudgetEvent payload from Go
+interface ContextChunkReport {
+  chunkId: number;
+  fileName: string;
+  page?: number;
+  score: number;
+  tokens: number;
+  trimmed?: boolean; // Only the beginning of the chunk was sent
+  reason?: string; // Why a chunk was dropped
+}
+
+interface ContextBudgetEventPayload {
+  requestId: string;
+  conversationId: string;
+  contextWindow: number;
+  budgetTokens: number;
+  usedTokens: number;
+  chosen: ContextChunkReport[];
+  dropped: ContextChunkReport[];
+}
+
+// formatContextBudget summarises which chunks fit into the context window
+const formatContextBudget = (event: ContextBudgetEventPayload) => {
+  const trimmed = event.chosen.filter((chunk) => chunk.trimmed).length;
+  let summary = `${event.chosen.length} chunks sent (${event.usedTokens}/${event.budgetTokens} tokens of a ${event.contextWindow}-token window)`;
+  if (trimmed > 0) {
+    summary += `, ${trimmed} trimmed`;
+  }
+  if (event.dropped.length > 0) {
+    summary += `, ${event.dropped.length} dropped`;
+  }
+  return summary;
+};
+
+// Define the structure of the indexStatus event payload from Go
+interface IndexStatusPayload {
+  chunks: number;
+  embeddingModel: string;
+  stale: boolean; // The embedding model changed; documents must be loaded again
+  message?: string;
+}
+
+// Define the structure of the backendStatus payload from Go
+interface BackendStatusPayload {
+  state: "unknown" | "up" | "down" | "degraded" | "model_missing";
+  ollamaUrl: string;
+  version?: string;
+  message?: string; // What is wrong and what to do; empty when up
+  models: {
+    missing: string[]; // Configured models that need to be pulled
+  };
+}
+
+// Define the structure of the modelPullEvent payload from Go
+interface ModelPullEventPayload {
+  model: string;
+  status: string;
+  percent?: number;
+  done: boolean;
+  error?: string;
+}
+
+// sourceLabel formats a source as e.g. "report.pdf p.3"
+const sourceLabel = (source: SourceInfo) => (source.page ? `${source.fileName} p.${source.page}` : source.fileName);
+
+// Define the structure of the data load progress event from Go
+interface DataLoadEventPayload {
+  status: "started" | "progress" | "done" | "cancelled" | "error";
+  message?: string;
+  error?: string;
+  currentFile?: string;
+  filesDone: number;
+  filesTotal: number;
+  chunksEmbedded: number;
+  chunksTotal: number;
+  errorCount: number;
+  etaSeconds?: number;
+}
+
+// formatLoadProgress turns a progress event into a one-line status message
+const formatLoadProgress = (event: DataLoadEventPayload) => {
+  const chunks = event.chunksTotal > 0 ? `${event.chunksEmbedded}/${event.chunksTotal}` : `${event.chunksEmbedded}`;
+  let status = `Indexing ${event.filesDone}/${event.filesTotal} files, ${chunks} chunks embedded`;
+  if (event.errorCount > 0) {
+    status += `, ${event.errorCount} errors`;
+  }
+  if (event.etaSeconds) {
+    status += ` (about ${Math.ceil(event.etaSeconds)}s left)`;
+  }
+  if (event.currentFile) {
+    status += ` - ${event.currentFile}`;
+  }
+  return status;
+};
+
 function App() {
   const [input, setInput] = useState<string>("");
+  const [filter, setFilter] = useState<string>(""); // Metadata filter such as "patient:1234 type:cardiology"
   const [messages, setMessages] = useState<Message[]>([]);
   const [dataLoadStatus, setDataLoadStatus] = useState<string>("");
   const [isLoading, setIsLoading] = useState(false); // Loading state for chat messages
   const [isDataLoading, setIsDataLoading] = useState(false); // Loading state for personal data
   const [dataLoadingStatus, setDataLoadingStatus] = useState<string>(""); // Status message for data loading
   const [ragSources, setRagSources] = useState<SourceInfo[]>([]); // State for RAG sources
+  const [contextBudget, setContextBudget] = useState<string>(""); // Which sources fit into the context window
+  const [backendStatus, setBackendStatus] = useState<BackendStatusPayload | null>(null); // Health of the Ollama server
+  const [pullStatus, setPullStatus] = useState<string>(""); // Progress of model downloads
+  const [templates, setTemplates] = useState<{ name: string; title: string }[]>([]); // Prompt templates from settings
+  const [templateName, setTemplateName] = useState<string>(""); // Template of this conversation; "" is the default
   const currentAiMessageIdRef = useRef<number | null>(null); // To track the ID of the AI message being streamed
+  const conversationIdRef = useRef<string>(""); // Backend conversation holding the chat history
+  const requestIdRef = useRef<string>(""); // Backend request ID of the answer being generated, for StopGeneration
+  const awaitingRequestIdRef = useRef<boolean>(false); // HandleMessage has not returned the request ID yet
+  const earlyEventsRef = useRef<{ requestId: string; replay: () => void }[]>([]); // Events that arrived before it did
   const messageEndRef = useRef<null | HTMLDivElement>(null);
 
   const scrollToBottom = () => {
@@ -48,6 +182,36 @@ function App() {
 
   useEffect(scrollToBottom, [messages]);
 
+  // Tells whether an event belongs to the answer being shown, so a late event of a
+  // stopped answer cannot end or fill the next one. Events can arrive before
+  // HandleMessage returns the request ID; those are held and replayed once it is known.
+  const isCurrentRequestEvent = (event: { requestId: string; conversationId: string }, replay: () => void) => {
+    if (event.conversationId !== conversationIdRef.current) {
+      return false;
+    }
+    if (awaitingRequestIdRef.current) {
+      earlyEventsRef.current.push({ requestId: event.requestId, replay });
+      return false;
+    }
+    return event.requestId === requestIdRef.current;
+  };
+
+  // Start a backend conversation so follow-up questions keep their context
+  useEffect(() => {
+    NewConversation()
+      .then((id) => {
+        conversationIdRef.current = id;
+      })
+      .catch((error) => console.error("Error starting conversation:", error));
+    GetSettings()
+      .then((settings) => setTemplates(settings.templates || []))
+      .catch((error) => console.error("Error loading settings:", error));
+    // The first health check may have run before this component was listening
+    GetBackendStatus()
+      .then(setBackendStatus)
+      .catch((error) => console.error("Error getting backend status:", error));
+  }, []);
+
   // Listen for streaming events from Go
   useEffect(() => {
     console.log("JS: App component mounted. Attempting to register ollamaStreamEvent listener.");
@@ -61,11 +225,18 @@ function App() {
     }
     */
 
-    const unlistenOllama = EventsOn("ollamaStreamEvent", (eventData: OllamaStreamEventPayload) => {
+    const onStreamEvent = (eventData: OllamaStreamEventPayload) => {
       // Removed the verbose log for every chunk:
       // console.log("JS: ollamaStreamEvent received in listener:", JSON.stringify(eventData));
 
-      if (eventData.done) {
+      // Ignore answers streamed into other conversations and earlier requests
+      if (!isCurrentRequestEvent(eventData, () => onStreamEvent(eventData))) {
+        return;
+      }
+
+      if (eventData.queued) {
+        console.log(`JS: Request ${eventData.requestId} is queued behind other answers.`);
+      } else if (eventData.done) {
         // Only process "done" if we are still expecting it for a specific message
         if (currentAiMessageIdRef.current !== null) {
           const messageIdToUpdate = currentAiMessageIdRef.current;
@@ -88,6 +259,7 @@ function App() {
                 durationMs: eventData.durationMs,
                 runesPerSecond: eventData.runesPerSecond,
                 isError: !!eventData.error,
+                isCancelled: !!eventData.cancelled,
               };
               if (eventData.error && newMessages[aiMessageIndex].text.length === 0) {
                 newMessages[aiMessageIndex].text = `[Error: ${eventData.error}]`;
@@ -142,12 +314,65 @@ function App() {
         console.warn("JS: Received event with non-string content (and not done):", JSON.stringify(eventData));
       }
       // No explicit return needed from EventsOn callback itself
+    };
+    const unlistenOllama = EventsOn("ollamaStreamEvent", onStreamEvent);
+
+    // Listener for background document loading progress
+    const unlistenDataLoad = EventsOn("dataLoadEvent", (event: DataLoadEventPayload) => {
+      switch (event.status) {
+        case "started":
+          setIsDataLoading(true);
+          setDataLoadingStatus(event.message || "Loading documents...");
+          break;
+        case "progress":
+          setDataLoadingStatus(formatLoadProgress(event));
+          break;
+        case "done":
+        case "cancelled":
+          setIsDataLoading(false);
+          setDataLoadingStatus(event.message || "");
+          break;
+        case "error":
+          setIsDataLoading(false);
+          setDataLoadingStatus(`Error loading documents: ${event.error}`);
+          break;
+      }
+    });
+
+    // Listener for index status changes, e.g. after the embedding model was changed in settings
+    const unlistenIndexStatus = EventsOn("indexStatus", (status: IndexStatusPayload) => {
+      if (status.stale && status.message) {
+        setDataLoadingStatus(status.message);
+      }
+    });
+
+    // Listeners for the health of the Ollama server and model downloads
+    const unlistenBackendStatus = EventsOn("backendStatus", (status: BackendStatusPayload) => setBackendStatus(status));
+    const unlistenModelPull = EventsOn("modelPullEvent", (event: ModelPullEventPayload) => {
+      if (event.error) {
+        setPullStatus(`Error pulling ${event.model}: ${event.error}`);
+      } else if (event.done) {
+        setPullStatus(`Pulled ${event.model}.`);
+      } else {
+        const percent = event.percent ? ` ${event.percent.toFixed(0)}%` : "";
+        setPullStatus(`Pulling ${event.model}: ${event.status}${percent}`);
+      }
     });
 
     // Listener for RAG context sources
-    const unlistenContext = EventsOn("ragSourcesEvent", (sources: SourceInfo[]) => {
-      console.log("JS: ragSourcesEvent received:", sources);
-      setRagSources(sources);
+    const unlistenContext = EventsOn("ragSourcesEvent", (event: RagSourcesEventPayload) => {
+      console.log("JS: ragSourcesEvent received:", event);
+      const showSources = () => setRagSources(event.sources);
+      if (isCurrentRequestEvent(event, showSources)) {
+        showSources();
+      }
+    });
+    const unlistenContextBudget = EventsOn("contextBudgetEvent", (event: ContextBudgetEventPayload) => {
+      console.log("JS: contextBudgetEvent received:", event);
+      const showBudget = () => setContextBudget(formatContextBudget(event));
+      if (isCurrentRequestEvent(event, showBudget)) {
+        showBudget();
+      }
     });
 
     if (typeof unlistenOllama === "function") {
@@ -167,6 +392,27 @@ function App() {
           console.warn("Error unsubscribing ollamaStreamEvent:", e);
         }
       }
+      if (unlistenDataLoad) {
+        try {
+          unlistenDataLoad();
+        } catch (e) {
+          console.warn("Error unsubscribing dataLoadEvent:", e);
+        }
+      }
+      if (unlistenIndexStatus) {
+        try {
+          unlistenIndexStatus();
+        } catch (e) {
+          console.warn("Error unsubscribing indexStatus:", e);
+        }
+      }
+      for (const unlisten of [unlistenBackendStatus, unlistenModelPull, unlistenContextBudget]) {
+        try {
+          unlisten();
+        } catch (e) {
+          console.warn("Error unsubscribing backend listener:", e);
+        }
+      }
       if (unlistenContext) {
         try {
           unlistenContext();
@@ -178,12 +424,13 @@ function App() {
   }, []); // Empty dependency array ensures this runs once on mount and cleans up on unmount
 
   const handleSendMessage = async () => {
-    if (input.trim() === "" || isLoading || isDataLoading) {
-      // Also disable send if data is loading
+    if (input.trim() === "" || isLoading) {
+      // Documents load in the background, so chatting stays available meanwhile
       return;
     }
     setIsLoading(true);
     setRagSources([]); // Clear previous RAG sources
+    setContextBudget("");
 
     const newUserMessage: Message = {
       id: Date.now(),
@@ -205,14 +452,27 @@ function App() {
     const currentInput = input;
     setInput("");
 
+    requestIdRef.current = "";
+    earlyEventsRef.current = [];
+    awaitingRequestIdRef.current = true;
     try {
-      await HandleMessage(currentInput);
+      const requestId = filter.trim()
+        ? await HandleMessageWithFilter(conversationIdRef.current, currentInput, {}, filter)
+        : await HandleMessage(conversationIdRef.current, currentInput);
+      requestIdRef.current = requestId;
+      awaitingRequestIdRef.current = false;
+      // Replay what this request streamed before its ID was known, in order
+      const early = earlyEventsRef.current;
+      earlyEventsRef.current = [];
+      early.filter((event) => event.requestId === requestId).forEach((event) => event.replay());
       // If HandleMessage completes without throwing an error,
       // it means the message was sent to the Go backend successfully.
       // Streaming will be handled by the EventsOn listener.
       // The 'isLoading' state will be set to false by the 'done' event from the stream.
     } catch (error) {
       console.error("Error calling HandleMessage (JS):", error);
+      awaitingRequestIdRef.current = false;
+      earlyEventsRef.current = [];
       setMessages((prevMessages) =>
         prevMessages.map((msg) =>
           msg.id === newAiMessageId ? { ...msg, text: `Sorry, an error occurred: ${error}`, isError: true } : msg
@@ -223,23 +483,62 @@ function App() {
     }
   };
 
+  const handleStopGeneration = async () => {
+    try {
+      // The final ollamaStreamEvent, marked as cancelled, ends the loading state
+      await StopGeneration(requestIdRef.current);
+    } catch (error: any) {
+      console.error("Error stopping generation:", error);
+    }
+  };
+
+  const handlePullMissingModels = async () => {
+    for (const model of backendStatus?.models?.missing || []) {
+      try {
+        await PullModel(model); // Progress arrives via modelPullEvent
+      } catch (error: any) {
+        setPullStatus(`Error pulling ${model}: ${error.message || String(error)}`);
+      }
+    }
+  };
+
+  const handleTemplateChange = async (name: string) => {
+    try {
+      await SetConversationTemplate(conversationIdRef.current, name);
+      setTemplateName(name);
+    } catch (error: any) {
+      console.error("Error selecting prompt template:", error);
+    }
+  };
+
   const handleLoadData = async () => {
     setIsDataLoading(true);
     setDataLoadingStatus("Requesting directory selection from user..."); // Updated status
     setRagSources([]); // Clear RAG sources when loading new data
     try {
-      // Call LoadPersonalData without arguments, as it now handles the dialog internally
+      // LoadPersonalData shows the dialog and starts a background job; progress arrives via dataLoadEvent
       const result = await LoadPersonalData();
       setDataLoadingStatus(result); // Display result from Go
       console.log("JS: LoadPersonalData result:", result);
+      if (result.startsWith("Document loading cancelled")) {
+        setIsDataLoading(false); // Dialog was closed, no job was started
+      }
     } catch (error: any) {
       console.error("Error loading personal data:", error);
       setDataLoadingStatus(`Error loading documents: ${error.message || String(error)}`);
-    } finally {
       setIsDataLoading(false);
     }
   };
 
+  const handleCancelLoad = async () => {
+    try {
+      await CancelLoad();
+      setDataLoadingStatus("Cancelling... files indexed so far are kept.");
+    } catch (error: any) {
+      console.error("Error cancelling data load:", error);
+    }
+  };
+
   return (
     <div id="App">
       <div className="chat-container">
@@ -285,7 +584,7 @@ function App() {
                         <ul>
                           {msg.sources.map((source, index) => (
                             <li key={index}>
-                              {source.fileName} (Chunk ID: {source.chunkId}, Score: {source.score.toFixed(4)})
+                              {sourceLabel(source)} (Chunk ID: {source.chunkId}, Score: {source.score.toFixed(4)})
                             </li>
                           ))}
                         </ul>
@@ -303,6 +602,7 @@ function App() {
                             <span>Speed: {msg.runesPerSecond.toFixed(1)} runes/s</span>
                           )}
                           {msg.isError && <span className="error-indicator"> (Error processing response)</span>}
+                          {msg.isCancelled && <span className="error-indicator"> (Stopped)</span>}
                         </div>
                       )}
                   </div>
@@ -321,14 +621,30 @@ function App() {
               {ragSources.map((source, index) => (
                 <li
                   key={index}
-                  className="rag-source-item"
-                  title={`File: \${source.fileName}\\nChunk ID: \${source.chunkId}\\nScore: \${source.score.toFixed(4)}`}
+                  className={source.sent ? "rag-source-item" : "rag-source-item not-sent"}
+                  title={`File: ${source.fileName}\nChunk ID: ${source.chunkId}\nScore: ${source.score.toFixed(4)}${
+                    source.sent ? "" : `\nNot sent: ${source.skipReason}`
+                  }`}
                 >
-                  {source.fileName.length > 25 ? `...\${source.fileName.slice(-22)}` : source.fileName} (Score:{" "}
-                  {source.score.toFixed(2)})
+                  {sourceLabel(source).length > 25 ? `...${sourceLabel(source).slice(-22)}` : sourceLabel(source)} (Score:{" "}
+                  {source.score.toFixed(2)}
+                  {source.rerankScore !== undefined && `, Rerank: ${source.rerankScore.toFixed(2)}`})
                 </li>
               ))}
             </ul>
+            {contextBudget && <p className="rag-sources-title">{contextBudget}</p>}
+          </div>
+        )}
+
+        {backendStatus?.message && (
+          <div className="data-loading-section">
+            <p className="data-loading-status">{backendStatus.message}</p>
+            {backendStatus.state === "model_missing" && (
+              <button className="load-data-button" onClick={handlePullMissingModels}>
+                Pull missing models
+              </button>
+            )}
+            {pullStatus && <p className="data-loading-status">{pullStatus}</p>}
           </div>
         )}
 
@@ -343,30 +659,60 @@ function App() {
               "Load Personal Data"
             )}
           </button>
+          {isDataLoading && (
+            <button className="load-data-button" onClick={handleCancelLoad}>
+              Cancel
+            </button>
+          )}
           {dataLoadingStatus && <p className="data-loading-status">{dataLoadingStatus}</p>}
         </div>
         <div className="input-area">
+          {templates.length > 0 && (
+            <select
+              className="template-select"
+              value={templateName}
+              onChange={(e) => handleTemplateChange(e.target.value)}
+              disabled={isLoading}
+              title="Prompt template for this conversation"
+            >
+              <option value="">Default template</option>
+              {templates.map((t) => (
+                <option key={t.name} value={t.name}>
+                  {t.title || t.name}
+                </option>
+              ))}
+            </select>
+          )}
+          <input
+            type="text"
+            className="filter-input"
+            value={filter}
+            onChange={(e) => setFilter(e.target.value)}
+            placeholder="Filter, e.g. patient:1234 type:cardiology"
+            title="Search only documents matching: patient, type, tag, path, after, before"
+            disabled={isLoading}
+          />
           <input
             type="text"
             className="chat-input"
             value={input}
             onChange={(e) => setInput(e.target.value)}
-            onKeyDown={(e) => e.key === "Enter" && !isLoading && !isDataLoading && handleSendMessage()} // Also check isDataLoading
-            placeholder={
-              isLoading ? "AI is thinking..." : isDataLoading ? "Loading documents..." : "Type your message..."
-            }
-            disabled={isLoading || isDataLoading}
+            onKeyDown={(e) => e.key === "Enter" && !isLoading && handleSendMessage()}
+            placeholder={isLoading ? "AI is thinking..." : "Type your message..."}
+            disabled={isLoading}
           />
-          <button className="send-button" onClick={handleSendMessage} disabled={isLoading || isDataLoading}>
-            {isLoading ? (
+          {isLoading ? (
+            <button className="send-button" onClick={handleStopGeneration}>
               <div style={{ display: "flex", alignItems: "center", justifyContent: "center" }}>
                 <div className="loader"></div>
-                <span style={{ marginLeft: "8px" }}>Sending...</span>
+                <span style={{ marginLeft: "8px" }}>Stop</span>
               </div>
-            ) : (
-              "Send"
-            )}
-          </button>
+            </button>
+          ) : (
+            <button className="send-button" onClick={handleSendMessage}>
+              Send
+            </button>
+          )}
         </div>
       </div>
     </div>
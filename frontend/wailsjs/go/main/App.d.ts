@@ -1,6 +1,63 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
+import {main} from '../models';
 
-export function HandleMessage(arg1:string):Promise<void>;
+export function BenchmarkEmbeddings(arg1:number):Promise<main.EmbeddingBenchmark>;
+
+export function CancelLoad():Promise<boolean>;
+
+export function CancelPull(arg1:string):Promise<boolean>;
+
+export function CheckModels():Promise<main.ModelCheck>;
+
+export function DeleteSession(arg1:string):Promise<void>;
+
+export function GetBackendStatus():Promise<main.BackendStatus>;
+
+export function GetChatOptions():Promise<main.ChatOptions>;
+
+export function GetIndexStatus():Promise<main.IndexStatus>;
+
+export function GetLoadOptions():Promise<main.LoadOptions>;
+
+export function GetRetrievalOptions():Promise<main.RetrievalOptions>;
+
+export function GetSettings():Promise<main.Settings>;
+
+export function HandleMessage(arg1:string,arg2:string):Promise<string>;
+
+export function HandleMessageWithFilter(arg1:string,arg2:string,arg3:main.GenerationOptions,arg4:string):Promise<string>;
+
+export function HandleMessageWithOptions(arg1:string,arg2:string,arg3:main.GenerationOptions):Promise<string>;
+
+export function ListModels():Promise<Array<main.ModelInfo>>;
+
+export function ListSessions():Promise<Array<main.SessionSummary>>;
 
 export function LoadPersonalData():Promise<string>;
+
+export function NewConversation():Promise<string>;
+
+export function OpenSession(arg1:string):Promise<main.Session>;
+
+export function PullModel(arg1:string):Promise<void>;
+
+export function RenameSession(arg1:string,arg2:string):Promise<void>;
+
+export function SearchSessions(arg1:string):Promise<Array<main.SessionSearchResult>>;
+
+export function SetChatOptions(arg1:main.ChatOptions):Promise<void>;
+
+export function SetConversationTemplate(arg1:string,arg2:string):Promise<void>;
+
+export function SetLoadOptions(arg1:main.LoadOptions):Promise<void>;
+
+export function SetRetrievalOptions(arg1:main.RetrievalOptions):Promise<void>;
+
+export function ShowModel(arg1:string):Promise<main.ModelDetails>;
+
+export function StopGeneration(arg1:string):Promise<boolean>;
+
+export function UpdateSettings(arg1:main.Settings):Promise<void>;
+
+export function VerifyVectorIndex(arg1:number):Promise<main.VectorIndexReport>;
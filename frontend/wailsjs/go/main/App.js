@@ -2,10 +2,122 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
-export function HandleMessage(arg1) {
-  return window['go']['main']['App']['HandleMessage'](arg1);
+export function BenchmarkEmbeddings(arg1) {
+  return window['go']['main']['App']['BenchmarkEmbeddings'](arg1);
+}
+
+export function CancelLoad() {
+  return window['go']['main']['App']['CancelLoad']();
+}
+
+export function CancelPull(arg1) {
+  return window['go']['main']['App']['CancelPull'](arg1);
+}
+
+export function CheckModels() {
+  return window['go']['main']['App']['CheckModels']();
+}
+
+export function DeleteSession(arg1) {
+  return window['go']['main']['App']['DeleteSession'](arg1);
+}
+
+export function GetBackendStatus() {
+  return window['go']['main']['App']['GetBackendStatus']();
+}
+
+export function GetChatOptions() {
+  return window['go']['main']['App']['GetChatOptions']();
+}
+
+export function GetIndexStatus() {
+  return window['go']['main']['App']['GetIndexStatus']();
+}
+
+export function GetLoadOptions() {
+  return window['go']['main']['App']['GetLoadOptions']();
+}
+
+export function GetRetrievalOptions() {
+  return window['go']['main']['App']['GetRetrievalOptions']();
+}
+
+export function GetSettings() {
+  return window['go']['main']['App']['GetSettings']();
+}
+
+export function HandleMessage(arg1, arg2) {
+  return window['go']['main']['App']['HandleMessage'](arg1, arg2);
+}
+
+export function HandleMessageWithFilter(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['HandleMessageWithFilter'](arg1, arg2, arg3, arg4);
+}
+
+export function HandleMessageWithOptions(arg1, arg2, arg3) {
+  return window['go']['main']['App']['HandleMessageWithOptions'](arg1, arg2, arg3);
+}
+
+export function ListModels() {
+  return window['go']['main']['App']['ListModels']();
+}
+
+export function ListSessions() {
+  return window['go']['main']['App']['ListSessions']();
 }
 
 export function LoadPersonalData() {
   return window['go']['main']['App']['LoadPersonalData']();
 }
+
+export function NewConversation() {
+  return window['go']['main']['App']['NewConversation']();
+}
+
+export function OpenSession(arg1) {
+  return window['go']['main']['App']['OpenSession'](arg1);
+}
+
+export function PullModel(arg1) {
+  return window['go']['main']['App']['PullModel'](arg1);
+}
+
+export function RenameSession(arg1, arg2) {
+  return window['go']['main']['App']['RenameSession'](arg1, arg2);
+}
+
+export function SearchSessions(arg1) {
+  return window['go']['main']['App']['SearchSessions'](arg1);
+}
+
+export function SetChatOptions(arg1) {
+  return window['go']['main']['App']['SetChatOptions'](arg1);
+}
+
+export function SetConversationTemplate(arg1, arg2) {
+  return window['go']['main']['App']['SetConversationTemplate'](arg1, arg2);
+}
+
+export function SetLoadOptions(arg1) {
+  return window['go']['main']['App']['SetLoadOptions'](arg1);
+}
+
+export function SetRetrievalOptions(arg1) {
+  return window['go']['main']['App']['SetRetrievalOptions'](arg1);
+}
+
+export function ShowModel(arg1) {
+  return window['go']['main']['App']['ShowModel'](arg1);
+}
+
+export function StopGeneration(arg1) {
+  return window['go']['main']['App']['StopGeneration'](arg1);
+}
+
+export function UpdateSettings(arg1) {
+  return window['go']['main']['App']['UpdateSettings'](arg1);
+}
+
+export function VerifyVectorIndex(arg1) {
+  return window['go']['main']['App']['VerifyVectorIndex'](arg1);
+}
@@ -0,0 +1,641 @@
+export namespace main {
+	
+	export class BackendStatus {
+	    state: string;
+	    ollamaUrl: string;
+	    version?: string;
+	    latencyMs?: number;
+	    message?: string;
+	    checkedAt?: string;
+	    models: ModelCheck;
+	
+	    static createFrom(source: any = {}) {
+	        return new BackendStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.state = source["state"];
+	        this.ollamaUrl = source["ollamaUrl"];
+	        this.version = source["version"];
+	        this.latencyMs = source["latencyMs"];
+	        this.message = source["message"];
+	        this.checkedAt = source["checkedAt"];
+	        this.models = this.convertValues(source["models"], ModelCheck);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ChatOptions {
+	    maxConcurrentGenerations: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ChatOptions(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.maxConcurrentGenerations = source["maxConcurrentGenerations"];
+	    }
+	}
+	export class EmbeddingBenchmark {
+	    chunks: number;
+	    dimensions: number;
+	    queries: number;
+	    k: number;
+	    float64Bytes: number;
+	    float32Bytes: number;
+	    int8Bytes: number;
+	    float32Micros: number;
+	    int8Micros: number;
+	    float32Recall: number;
+	    int8Recall: number;
+	    int8RescoreRecall: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new EmbeddingBenchmark(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.chunks = source["chunks"];
+	        this.dimensions = source["dimensions"];
+	        this.queries = source["queries"];
+	        this.k = source["k"];
+	        this.float64Bytes = source["float64Bytes"];
+	        this.float32Bytes = source["float32Bytes"];
+	        this.int8Bytes = source["int8Bytes"];
+	        this.float32Micros = source["float32Micros"];
+	        this.int8Micros = source["int8Micros"];
+	        this.float32Recall = source["float32Recall"];
+	        this.int8Recall = source["int8Recall"];
+	        this.int8RescoreRecall = source["int8RescoreRecall"];
+	    }
+	}
+	export class GenerationOptions {
+	    temperature?: number;
+	    topP?: number;
+	    numCtx?: number;
+	    numPredict?: number;
+	    seed?: number;
+	    repeatPenalty?: number;
+	    stop?: string[];
+	    keepAlive?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new GenerationOptions(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.temperature = source["temperature"];
+	        this.topP = source["topP"];
+	        this.numCtx = source["numCtx"];
+	        this.numPredict = source["numPredict"];
+	        this.seed = source["seed"];
+	        this.repeatPenalty = source["repeatPenalty"];
+	        this.stop = source["stop"];
+	        this.keepAlive = source["keepAlive"];
+	    }
+	}
+	export class IndexStatus {
+	    chunks: number;
+	    embeddingModel: string;
+	    stale: boolean;
+	    message?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new IndexStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.chunks = source["chunks"];
+	        this.embeddingModel = source["embeddingModel"];
+	        this.stale = source["stale"];
+	        this.message = source["message"];
+	    }
+	}
+	export class LoadOptions {
+	    includePatterns: string[];
+	    excludePatterns: string[];
+	    followSymlinks: boolean;
+	    embedBatchSize: number;
+	    embedConcurrency: number;
+	    tagRules: TagRule[];
+	    patientPathSegment: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new LoadOptions(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.includePatterns = source["includePatterns"];
+	        this.excludePatterns = source["excludePatterns"];
+	        this.followSymlinks = source["followSymlinks"];
+	        this.embedBatchSize = source["embedBatchSize"];
+	        this.embedConcurrency = source["embedConcurrency"];
+	        this.tagRules = this.convertValues(source["tagRules"], TagRule);
+	        this.patientPathSegment = source["patientPathSegment"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class LoadSummary {
+	    directory: string;
+	    added: string[];
+	    updated: string[];
+	    removed: string[];
+	    unchanged: string[];
+	    failed: string[];
+	    skipped: SkippedFile[];
+	    chunksLoaded: number;
+	    message: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new LoadSummary(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.directory = source["directory"];
+	        this.added = source["added"];
+	        this.updated = source["updated"];
+	        this.removed = source["removed"];
+	        this.unchanged = source["unchanged"];
+	        this.failed = source["failed"];
+	        this.skipped = this.convertValues(source["skipped"], SkippedFile);
+	        this.chunksLoaded = source["chunksLoaded"];
+	        this.message = source["message"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ModelCheck {
+	    reachable: boolean;
+	    chatModel: string;
+	    chatModelInstalled: boolean;
+	    embeddingModel: string;
+	    embeddingModelInstalled: boolean;
+	    missing: string[];
+	    message?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ModelCheck(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.reachable = source["reachable"];
+	        this.chatModel = source["chatModel"];
+	        this.chatModelInstalled = source["chatModelInstalled"];
+	        this.embeddingModel = source["embeddingModel"];
+	        this.embeddingModelInstalled = source["embeddingModelInstalled"];
+	        this.missing = source["missing"];
+	        this.message = source["message"];
+	    }
+	}
+	export class ModelDetails {
+	    name: string;
+	    family?: string;
+	    format?: string;
+	    parameterSize?: string;
+	    quantizationLevel?: string;
+	    contextLength?: number;
+	    embeddingLength?: number;
+	    parameters?: string;
+	    template?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ModelDetails(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.family = source["family"];
+	        this.format = source["format"];
+	        this.parameterSize = source["parameterSize"];
+	        this.quantizationLevel = source["quantizationLevel"];
+	        this.contextLength = source["contextLength"];
+	        this.embeddingLength = source["embeddingLength"];
+	        this.parameters = source["parameters"];
+	        this.template = source["template"];
+	    }
+	}
+	export class ModelInfo {
+	    name: string;
+	    size: number;
+	    digest: string;
+	    modifiedAt: string;
+	    family?: string;
+	    parameterSize?: string;
+	    quantizationLevel?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ModelInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.size = source["size"];
+	        this.digest = source["digest"];
+	        this.modifiedAt = source["modifiedAt"];
+	        this.family = source["family"];
+	        this.parameterSize = source["parameterSize"];
+	        this.quantizationLevel = source["quantizationLevel"];
+	    }
+	}
+	export class PromptTemplate {
+	    name: string;
+	    title: string;
+	    systemPrompt: string;
+	    contextTemplate: string;
+	    noContextTemplate: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new PromptTemplate(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.title = source["title"];
+	        this.systemPrompt = source["systemPrompt"];
+	        this.contextTemplate = source["contextTemplate"];
+	        this.noContextTemplate = source["noContextTemplate"];
+	    }
+	}
+	export class RetrievalOptions {
+	    mode: string;
+	    fusion: string;
+	    keywordWeight: number;
+	    topN: number;
+	    minScore: number;
+	    keywordMinScore: number;
+	    hybridMinScore: number;
+	    rerankMinScore: number;
+	    relativeCutoff: number;
+	    rerank: boolean;
+	    rerankModel: string;
+	    rerankCandidates: number;
+	    mmrLambda: number;
+	    maxChunksPerFile: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new RetrievalOptions(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.mode = source["mode"];
+	        this.fusion = source["fusion"];
+	        this.keywordWeight = source["keywordWeight"];
+	        this.topN = source["topN"];
+	        this.minScore = source["minScore"];
+	        this.keywordMinScore = source["keywordMinScore"];
+	        this.hybridMinScore = source["hybridMinScore"];
+	        this.rerankMinScore = source["rerankMinScore"];
+	        this.relativeCutoff = source["relativeCutoff"];
+	        this.rerank = source["rerank"];
+	        this.rerankModel = source["rerankModel"];
+	        this.rerankCandidates = source["rerankCandidates"];
+	        this.mmrLambda = source["mmrLambda"];
+	        this.maxChunksPerFile = source["maxChunksPerFile"];
+	    }
+	}
+	export class Session {
+	    id: string;
+	    title: string;
+	    createdAt: any;
+	    updatedAt: any;
+	    template?: string;
+	    messages: SessionMessage[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Session(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.title = source["title"];
+	        this.createdAt = source["createdAt"];
+	        this.updatedAt = source["updatedAt"];
+	        this.template = source["template"];
+	        this.messages = this.convertValues(source["messages"], SessionMessage);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class SessionMessage {
+	    role: string;
+	    content: string;
+	    sources?: SourceInfo[];
+	    durationMs?: number;
+	    runesPerSecond?: number;
+	    error?: string;
+	    cancelled?: boolean;
+	    model?: string;
+	    options?: GenerationOptions;
+	    createdAt: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new SessionMessage(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.role = source["role"];
+	        this.content = source["content"];
+	        this.sources = this.convertValues(source["sources"], SourceInfo);
+	        this.durationMs = source["durationMs"];
+	        this.runesPerSecond = source["runesPerSecond"];
+	        this.error = source["error"];
+	        this.cancelled = source["cancelled"];
+	        this.model = source["model"];
+	        this.options = this.convertValues(source["options"], GenerationOptions);
+	        this.createdAt = source["createdAt"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class SessionSearchResult {
+	    id: string;
+	    title: string;
+	    createdAt: string;
+	    updatedAt: string;
+	    messageCount: number;
+	    snippet: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SessionSearchResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.title = source["title"];
+	        this.createdAt = source["createdAt"];
+	        this.updatedAt = source["updatedAt"];
+	        this.messageCount = source["messageCount"];
+	        this.snippet = source["snippet"];
+	    }
+	}
+	export class SessionSummary {
+	    id: string;
+	    title: string;
+	    createdAt: string;
+	    updatedAt: string;
+	    messageCount: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new SessionSummary(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.title = source["title"];
+	        this.createdAt = source["createdAt"];
+	        this.updatedAt = source["updatedAt"];
+	        this.messageCount = source["messageCount"];
+	    }
+	}
+	export class Settings {
+	    ollamaUrl: string;
+	    chatModel: string;
+	    embeddingModel: string;
+	    load: LoadOptions;
+	    chat: ChatOptions;
+	    retrieval: RetrievalOptions;
+	    vectorIndex: VectorIndexOptions;
+	    generation: GenerationOptions;
+	    templates: PromptTemplate[];
+	    defaultTemplate: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Settings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.ollamaUrl = source["ollamaUrl"];
+	        this.chatModel = source["chatModel"];
+	        this.embeddingModel = source["embeddingModel"];
+	        this.load = this.convertValues(source["load"], LoadOptions);
+	        this.chat = this.convertValues(source["chat"], ChatOptions);
+	        this.retrieval = this.convertValues(source["retrieval"], RetrievalOptions);
+	        this.vectorIndex = this.convertValues(source["vectorIndex"], VectorIndexOptions);
+	        this.generation = this.convertValues(source["generation"], GenerationOptions);
+	        this.templates = this.convertValues(source["templates"], PromptTemplate);
+	        this.defaultTemplate = source["defaultTemplate"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class SkippedFile {
+	    file: string;
+	    reason: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SkippedFile(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.file = source["file"];
+	        this.reason = source["reason"];
+	    }
+	}
+	export class SourceInfo {
+	    fileName: string;
+	    page?: number;
+	    chunkId: number;
+	    score: number;
+	    vectorScore?: number;
+	    keywordScore?: number;
+	    rerankScore?: number;
+	    sent: boolean;
+	    skipReason?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SourceInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.fileName = source["fileName"];
+	        this.page = source["page"];
+	        this.chunkId = source["chunkId"];
+	        this.score = source["score"];
+	        this.vectorScore = source["vectorScore"];
+	        this.keywordScore = source["keywordScore"];
+	        this.rerankScore = source["rerankScore"];
+	        this.sent = source["sent"];
+	        this.skipReason = source["skipReason"];
+	    }
+	}
+	export class TagRule {
+	    pattern: string;
+	    tags: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new TagRule(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.pattern = source["pattern"];
+	        this.tags = source["tags"];
+	    }
+	}
+	export class VectorIndexOptions {
+	    type: string;
+	    m: number;
+	    efConstruction: number;
+	    efSearch: number;
+	    quantization: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new VectorIndexOptions(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.type = source["type"];
+	        this.m = source["m"];
+	        this.efConstruction = source["efConstruction"];
+	        this.efSearch = source["efSearch"];
+	        this.quantization = source["quantization"];
+	    }
+	}
+	export class VectorIndexReport {
+	    nodes: number;
+	    queries: number;
+	    k: number;
+	    recall: number;
+	    indexMicros: number;
+	    exactMicros: number;
+	    efSearch: number;
+	    efConstruction: number;
+	    m: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new VectorIndexReport(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.nodes = source["nodes"];
+	        this.queries = source["queries"];
+	        this.k = source["k"];
+	        this.recall = source["recall"];
+	        this.indexMicros = source["indexMicros"];
+	        this.exactMicros = source["exactMicros"];
+	        this.efSearch = source["efSearch"];
+	        this.efConstruction = source["efConstruction"];
+	        this.m = source["m"];
+	    }
+	}
+
+}
+
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	defaultMaxConcurrentGenerations = 1 // Ollama answers one request at a time unless OLLAMA_NUM_PARALLEL is raised
+	maxConcurrentGenerationsLimit   = 8 // Upper bound accepted by ChatOptions validation
+)
+
+// ChatOptions controls how concurrent HandleMessage calls are scheduled.
+type ChatOptions struct {
+	// MaxConcurrentGenerations is the number of answers generated in parallel. With 1,
+	// requests are queued and answered one at a time; with more, requests from different
+	// conversations run in parallel and only the excess is queued.
+	MaxConcurrentGenerations int `json:"maxConcurrentGenerations"`
+}
+
+// defaultChatOptions returns the chat options used until the user changes them.
+func defaultChatOptions() ChatOptions {
+	return ChatOptions{MaxConcurrentGenerations: defaultMaxConcurrentGenerations}
+}
+
+// validate checks that the options are usable.
+func (o ChatOptions) validate() error {
+	if o.MaxConcurrentGenerations < 1 || o.MaxConcurrentGenerations > maxConcurrentGenerationsLimit {
+		return fmt.Errorf("max concurrent generations must be between 1 and %d", maxConcurrentGenerationsLimit)
+	}
+	return nil
+}
+
+// GetChatOptions is a Wails-bindable method that returns the current chat options.
+func (a *App) GetChatOptions() ChatOptions {
+	return a.currentSettings().Chat
+}
+
+// SetChatOptions is a Wails-bindable method that replaces the chat options. A new
+// concurrency limit applies immediately, also to requests already queued. The options
+// are saved with the settings.
+func (a *App) SetChatOptions(options ChatOptions) error {
+	if err := a.updateSettings(func(s *Settings) { s.Chat = options }); err != nil {
+		return err
+	}
+	log.Printf("Chat options updated: %+v", options)
+	return nil
+}
+
+// generation is one HandleMessage call, from queueing to the end of its answer.
+type generation struct {
+	ctx            context.Context // Cancelled by StopGeneration
+	cancel         context.CancelFunc
+	requestID      string
+	conversationID string
+	model          string            // Chat model, fixed when the request is made
+	options        GenerationOptions // Settings merged with the per-request overrides
+	filter         chunkFilter       // Restricts retrieval to matching chunks; empty searches all
+}
+
+// startGeneration registers a new answer generation for a conversation.
+// finishGeneration must be called when it ends.
+func (a *App) startGeneration(conversationID, model string, options GenerationOptions) *generation {
+	ctx, cancel := context.WithCancel(a.ctx)
+	gen := &generation{
+		ctx:            ctx,
+		cancel:         cancel,
+		requestID:      newID(),
+		conversationID: conversationID,
+		model:          model,
+		options:        options,
+	}
+	a.genMu.Lock()
+	defer a.genMu.Unlock()
+	a.generations[gen.requestID] = gen
+	return gen
+}
+
+// finishGeneration releases the context of a generation that has ended.
+func (a *App) finishGeneration(requestID string) {
+	a.genMu.Lock()
+	defer a.genMu.Unlock()
+	if gen, ok := a.generations[requestID]; ok {
+		gen.cancel()
+		delete(a.generations, requestID)
+	}
+}
+
+// StopGeneration is a Wails-bindable method that aborts the answer being generated, or
+// still queued, for the request ID returned by HandleMessage. The stream ends with a
+// final ollamaStreamEvent marked as cancelled, carrying the metrics of the partial
+// answer. It reports whether the generation was still running.
+func (a *App) StopGeneration(requestID string) bool {
+	a.genMu.Lock()
+	defer a.genMu.Unlock()
+	gen, ok := a.generations[requestID]
+	if !ok {
+		return false
+	}
+	log.Printf("StopGeneration called. Stopping generation %s.", requestID)
+	gen.cancel()
+	return true
+}
+
+// emitStreamEvent sends an ollamaStreamEvent tagged with the request and conversation
+// of gen, so the frontend can tell overlapping answers apart.
+func (a *App) emitStreamEvent(gen *generation, event OllamaStreamEvent) {
+	event.RequestID = gen.requestID
+	event.ConversationID = gen.conversationID
+	runtime.EventsEmit(a.ctx, "ollamaStreamEvent", event)
+}
+
+// acquireGenerationSlot waits for the limiter to admit gen, telling the frontend with a
+// queued event if it has to wait. It fails if gen is stopped while waiting.
+func (a *App) acquireGenerationSlot(gen *generation) error {
+	if a.limiter.tryAcquire() {
+		return nil
+	}
+	log.Printf("Request %s queued: all generation slots are busy.", gen.requestID)
+	a.emitStreamEvent(gen, OllamaStreamEvent{Queued: true})
+	return a.limiter.acquire(gen.ctx)
+}
+
+// generationLimiter is a counting semaphore that admits waiters in arrival order and
+// whose limit can change while requests are waiting.
+type generationLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	running int
+	waiters []chan struct{} // Closed when the waiter is admitted, oldest first
+}
+
+// newGenerationLimiter returns a limiter admitting limit holders at once.
+func newGenerationLimiter(limit int) *generationLimiter {
+	return &generationLimiter{limit: limit}
+}
+
+// tryAcquire takes a slot if one is free and nobody is waiting.
+func (l *generationLimiter) tryAcquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.running < l.limit && len(l.waiters) == 0 {
+		l.running++
+		return true
+	}
+	return false
+}
+
+// acquire waits for a slot. It returns ctx.Err() if ctx ends first.
+func (l *generationLimiter) acquire(ctx context.Context) error {
+	l.mu.Lock()
+	if l.running < l.limit && len(l.waiters) == 0 {
+		l.running++
+		l.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	l.waiters = append(l.waiters, ready)
+	l.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for i, waiter := range l.waiters {
+			if waiter == ready {
+				l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+				return ctx.Err()
+			}
+		}
+		// Admitted just as ctx ended: hand the slot on.
+		l.running--
+		l.admitLocked()
+		return ctx.Err()
+	}
+}
+
+// release frees a slot taken by tryAcquire or acquire.
+func (l *generationLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running--
+	l.admitLocked()
+}
+
+// setLimit changes the number of slots. Raising it admits waiting requests at once;
+// lowering it lets running ones finish.
+func (l *generationLimiter) setLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.admitLocked()
+}
+
+// admitLocked admits waiters while slots are free. The caller must hold l.mu.
+func (l *generationLimiter) admitLocked() {
+	for l.running < l.limit && len(l.waiters) > 0 {
+		l.running++
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxStopSequences = 8 // Upper bound on GenerationOptions.Stop
+
+// GenerationOptions are the sampling and runtime options sent to Ollama with a chat
+// request. Unset (nil or empty) fields leave the model's default in place. The
+// settings hold the defaults; HandleMessageWithOptions can override them per request.
+type GenerationOptions struct {
+	Temperature   *float64 `json:"temperature,omitempty"`   // 0 makes answers deterministic together with Seed
+	TopP          *float64 `json:"topP,omitempty"`          // Nucleus sampling cut-off, between 0 and 1
+	NumCtx        *int     `json:"numCtx,omitempty"`        // Context window in tokens
+	NumPredict    *int     `json:"numPredict,omitempty"`    // Maximum tokens to generate, at least 1; -1 is unlimited
+	Seed          *int     `json:"seed,omitempty"`          // Fixed seed for reproducible answers
+	RepeatPenalty *float64 `json:"repeatPenalty,omitempty"` // Penalty for repeated tokens; 1 disables it
+	Stop          []string `json:"stop,omitempty"`          // Sequences that end the answer
+	KeepAlive     string   `json:"keepAlive,omitempty"`     // How long Ollama keeps the model loaded, e.g. "10m", "0" or "-1"
+}
+
+// ollamaOptions is the options object of Ollama's chat API.
+type ollamaOptions struct {
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          *float64 `json:"top_p,omitempty"`
+	NumCtx        *int     `json:"num_ctx,omitempty"`
+	NumPredict    *int     `json:"num_predict,omitempty"`
+	Seed          *int     `json:"seed,omitempty"`
+	RepeatPenalty *float64 `json:"repeat_penalty,omitempty"`
+	Stop          []string `json:"stop,omitempty"`
+}
+
+// validate checks that the options are within the ranges Ollama accepts.
+func (o GenerationOptions) validate() error {
+	if o.Temperature != nil && (*o.Temperature < 0 || *o.Temperature > 2) {
+		return errors.New("temperature must be between 0 and 2")
+	}
+	if o.TopP != nil && (*o.TopP <= 0 || *o.TopP > 1) {
+		return errors.New("top_p must be greater than 0 and at most 1")
+	}
+	if o.NumCtx != nil && *o.NumCtx < 1 {
+		return errors.New("num_ctx must be positive")
+	}
+	if o.NumPredict != nil && *o.NumPredict < 1 && *o.NumPredict != -1 {
+		return errors.New("num_predict must be -1 (unlimited) or a positive number of tokens")
+	}
+	if o.RepeatPenalty != nil && *o.RepeatPenalty <= 0 {
+		return errors.New("repeat_penalty must be positive")
+	}
+	if len(o.Stop) > maxStopSequences {
+		return fmt.Errorf("at most %d stop sequences are allowed", maxStopSequences)
+	}
+	for _, stop := range o.Stop {
+		if stop == "" {
+			return errors.New("stop sequences must not be empty")
+		}
+	}
+	if o.KeepAlive != "" {
+		if _, err := strconv.Atoi(o.KeepAlive); err != nil {
+			if _, err := time.ParseDuration(o.KeepAlive); err != nil {
+				return fmt.Errorf("keep_alive %q must be a duration such as \"10m\" or a number of seconds", o.KeepAlive)
+			}
+		}
+	}
+	return nil
+}
+
+// normalize removes surrounding spaces from KeepAlive.
+func (o *GenerationOptions) normalize() {
+	o.KeepAlive = strings.TrimSpace(o.KeepAlive)
+}
+
+// merge returns o with every field set in override replacing the one in o.
+func (o GenerationOptions) merge(override GenerationOptions) GenerationOptions {
+	if override.Temperature != nil {
+		o.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		o.TopP = override.TopP
+	}
+	if override.NumCtx != nil {
+		o.NumCtx = override.NumCtx
+	}
+	if override.NumPredict != nil {
+		o.NumPredict = override.NumPredict
+	}
+	if override.Seed != nil {
+		o.Seed = override.Seed
+	}
+	if override.RepeatPenalty != nil {
+		o.RepeatPenalty = override.RepeatPenalty
+	}
+	if override.Stop != nil {
+		o.Stop = override.Stop
+	}
+	if override.KeepAlive != "" {
+		o.KeepAlive = override.KeepAlive
+	}
+	return o
+}
+
+// ollamaOptions converts the options to the options object of a chat request. It
+// returns nil when no option is set, so the field is left out.
+func (o GenerationOptions) ollamaOptions() *ollamaOptions {
+	if o.Temperature == nil && o.TopP == nil && o.NumCtx == nil && o.NumPredict == nil &&
+		o.Seed == nil && o.RepeatPenalty == nil && len(o.Stop) == 0 {
+		return nil
+	}
+	return &ollamaOptions{
+		Temperature:   o.Temperature,
+		TopP:          o.TopP,
+		NumCtx:        o.NumCtx,
+		NumPredict:    o.NumPredict,
+		Seed:          o.Seed,
+		RepeatPenalty: o.RepeatPenalty,
+		Stop:          o.Stop,
+	}
+}
+
+// internalOptions returns the options of an internal prompt made for an answer, such
+// as the rewrite of a follow-up question. Decoding is greedy and uses the request's
+// seed and context window, so the same request retrieves the same chunks; the user's
+// sampling options and stop sequences are meant for the answer and are left out.
+func (o GenerationOptions) internalOptions(maxTokens int) *ollamaOptions {
+	temperature := 0.0
+	return &ollamaOptions{
+		Temperature: &temperature,
+		NumCtx:      o.NumCtx,
+		NumPredict:  &maxTokens,
+		Seed:        o.Seed,
+	}
+}
+
+// ollamaKeepAlive converts KeepAlive to the keep_alive value of a chat request: Ollama
+// reads plain numbers as seconds but rejects them inside a string, so they are sent as
+// numbers and durations such as "10m" as strings. It returns nil when unset.
+func (o GenerationOptions) ollamaKeepAlive() interface{} {
+	if o.KeepAlive == "" {
+		return nil
+	}
+	if seconds, err := strconv.Atoi(o.KeepAlive); err == nil {
+		return seconds
+	}
+	return o.KeepAlive
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestGenerationOptionsValidateNumPredict(t *testing.T) {
+	tests := []struct {
+		numPredict int
+		wantErr    bool
+	}{
+		{-3, true},
+		{-2, true},
+		{-1, false},
+		{0, true},
+		{1, false},
+		{512, false},
+	}
+	for _, tt := range tests {
+		numPredict := tt.numPredict
+		err := GenerationOptions{NumPredict: &numPredict}.validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validate() with num_predict %d error = %v, wantErr %t", tt.numPredict, err, tt.wantErr)
+		}
+	}
+	if err := (GenerationOptions{}).validate(); err != nil {
+		t.Errorf("validate() without num_predict error = %v", err)
+	}
+}
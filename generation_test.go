@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitForWaiters blocks until n requests are queued on the limiter.
+func waitForWaiters(t *testing.T, l *generationLimiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		l.mu.Lock()
+		queued := len(l.waiters)
+		l.mu.Unlock()
+		if queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d requests queued, want %d", queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// limiterState returns the running and queued counts of the limiter.
+func limiterState(l *generationLimiter) (running, queued int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.running, len(l.waiters)
+}
+
+func TestGenerationLimiterFIFO(t *testing.T) {
+	l := newGenerationLimiter(1)
+	if !l.tryAcquire() {
+		t.Fatal("tryAcquire() on a free limiter = false")
+	}
+	admitted := make(chan int)
+	for i := 0; i < 5; i++ {
+		go func() {
+			if err := l.acquire(context.Background()); err != nil {
+				t.Errorf("acquire() error = %v", err)
+			}
+			admitted <- i
+		}()
+		waitForWaiters(t, l, i+1) // Queue them one after the other
+	}
+	if l.tryAcquire() {
+		t.Fatal("tryAcquire() jumped the queue")
+	}
+
+	for want := 0; want < 5; want++ {
+		l.release()
+		select {
+		case got := <-admitted:
+			if got != want {
+				t.Fatalf("request %d admitted, want %d", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("request %d not admitted after a release", want)
+		}
+	}
+	l.release()
+	if running, queued := limiterState(l); running != 0 || queued != 0 {
+		t.Errorf("after releasing everything: %d running, %d queued", running, queued)
+	}
+}
+
+func TestGenerationLimiterCancelWhileQueued(t *testing.T) {
+	tests := []struct {
+		name   string
+		cancel int // Index of the waiter cancelled, of three
+	}{
+		{"first", 0},
+		{"middle", 1},
+		{"last", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newGenerationLimiter(1)
+			l.tryAcquire()
+			results := make([]chan error, 3)
+			cancels := make([]context.CancelFunc, 3)
+			for i := range results {
+				var ctx context.Context
+				ctx, cancels[i] = context.WithCancel(context.Background())
+				defer cancels[i]()
+				results[i] = make(chan error, 1)
+				go func() { results[i] <- l.acquire(ctx) }()
+				waitForWaiters(t, l, i+1)
+			}
+
+			cancels[tt.cancel]()
+			if err := <-results[tt.cancel]; !errors.Is(err, context.Canceled) {
+				t.Fatalf("cancelled acquire() error = %v, want context.Canceled", err)
+			}
+			if running, queued := limiterState(l); running != 1 || queued != 2 {
+				t.Fatalf("after cancelling: %d running, %d queued; want 1 and 2", running, queued)
+			}
+
+			// The others are still admitted in order, one per release
+			for i := range results {
+				if i == tt.cancel {
+					continue
+				}
+				l.release()
+				if err := <-results[i]; err != nil {
+					t.Fatalf("acquire() %d error = %v", i, err)
+				}
+			}
+			l.release()
+			if running, queued := limiterState(l); running != 0 || queued != 0 {
+				t.Errorf("after releasing everything: %d running, %d queued", running, queued)
+			}
+		})
+	}
+}
+
+func TestGenerationLimiterCancelAsAdmitted(t *testing.T) {
+	// A waiter admitted just as its context ends either keeps the slot or hands it on;
+	// either way no slot is lost.
+	for i := 0; i < 100; i++ {
+		l := newGenerationLimiter(1)
+		l.tryAcquire()
+		ctx, cancel := context.WithCancel(context.Background())
+		result := make(chan error, 1)
+		go func() { result <- l.acquire(ctx) }()
+		waitForWaiters(t, l, 1)
+
+		l.mu.Lock()
+		l.running--
+		l.admitLocked()
+		cancel()
+		l.mu.Unlock()
+		if err := <-result; err == nil {
+			l.release()
+		}
+		if running, queued := limiterState(l); running != 0 || queued != 0 {
+			t.Fatalf("after the race: %d running, %d queued", running, queued)
+		}
+	}
+}
+
+func TestStopGenerationReleasesQueuedSlot(t *testing.T) {
+	a := NewApp()
+	a.ctx = context.Background()
+	a.limiter.setLimit(1)
+
+	running := a.startGeneration("a", "model", GenerationOptions{})
+	if err := a.limiter.acquire(running.ctx); err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	queued := a.startGeneration("b", "model", GenerationOptions{})
+	result := make(chan error, 1)
+	go func() { result <- a.limiter.acquire(queued.ctx) }()
+	waitForWaiters(t, a.limiter, 1)
+
+	if !a.StopGeneration(queued.requestID) {
+		t.Fatal("StopGeneration() of a queued request = false")
+	}
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Fatalf("acquire() of the stopped request error = %v, want context.Canceled", err)
+	}
+	a.finishGeneration(queued.requestID)
+	if a.StopGeneration(queued.requestID) {
+		t.Error("StopGeneration() of a finished request = true")
+	}
+
+	// Stopping the running request frees its slot once it releases it, as answerMessage does
+	a.StopGeneration(running.requestID)
+	a.limiter.release()
+	a.finishGeneration(running.requestID)
+	if running, queued := limiterState(a.limiter); running != 0 || queued != 0 {
+		t.Fatalf("after stopping both: %d running, %d queued", running, queued)
+	}
+	if !a.limiter.tryAcquire() {
+		t.Error("the slot was not released after StopGeneration")
+	}
+}
@@ -4,6 +4,7 @@ go 1.23
 
 require (
 	github.com/go-ole/go-ole v1.3.0
+	github.com/ledongthuc/pdf v0.0.0-20240201131950-da5b75280b06
 	github.com/wailsapp/wails/v2 v2.10.1
 )
 
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	healthCheckInterval     = 15 * time.Second // Time between health checks while Ollama is reachable
+	healthCheckDownInterval = 5 * time.Second  // Time between health checks while it is not, to notice recovery quickly
+	healthCheckTimeout      = 3 * time.Second  // Time allowed for /api/version
+	healthSlowThreshold     = 2 * time.Second  // Response time above which the backend is reported as degraded
+)
+
+// Backend states reported in BackendStatus.State.
+const (
+	backendUnknown      = "unknown" // No check has completed yet
+	backendUp           = "up"
+	backendDown         = "down"          // The server does not answer
+	backendDegraded     = "degraded"      // The server answers, but slowly or with errors
+	backendModelMissing = "model_missing" // A configured model is not installed
+)
+
+// BackendStatus is the payload of backendStatus, emitted whenever the state of the
+// Ollama server changes.
+type BackendStatus struct {
+	State     string     `json:"state"` // One of "unknown", "up", "down", "degraded" or "model_missing"
+	OllamaURL string     `json:"ollamaUrl"`
+	Version   string     `json:"version,omitempty"`   // Ollama server version
+	LatencyMs int64      `json:"latencyMs,omitempty"` // Response time of /api/version; a change alone is not emitted
+	Message   string     `json:"message,omitempty"`   // What is wrong and what to do; empty when up
+	CheckedAt string     `json:"checkedAt,omitempty"` // RFC 3339
+	Models    ModelCheck `json:"models"`
+}
+
+// ollamaVersionResponse is the response of /api/version.
+type ollamaVersionResponse struct {
+	Version string `json:"version"`
+}
+
+// probeBackend checks the Ollama server and the configured models once.
+func (a *App) probeBackend() BackendStatus {
+	settings := a.currentSettings()
+	status := BackendStatus{OllamaURL: settings.OllamaURL, CheckedAt: time.Now().Format(time.RFC3339)}
+
+	ctx, cancel := context.WithTimeout(a.ctx, healthCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	var version ollamaVersionResponse
+	if err := a.ollamaJSON(ctx, "version", nil, &version); err != nil {
+		status.State = backendDown
+		status.Message = fmt.Sprintf("Ollama is not reachable at %s (%v). Start Ollama or change the server in the settings.", settings.OllamaURL, err)
+		return status
+	}
+	latency := time.Since(start)
+	status.LatencyMs = latency.Milliseconds()
+	status.Version = version.Version
+
+	status.Models = a.checkModels()
+	switch {
+	case !status.Models.Reachable:
+		status.State = backendDegraded
+		status.Message = fmt.Sprintf("Ollama %s answers at %s but could not list its models. Answers may fail until it recovers.", status.Version, settings.OllamaURL)
+	case len(status.Models.Missing) > 0:
+		status.State = backendModelMissing
+		status.Message = status.Models.Message
+	case latency > healthSlowThreshold:
+		status.State = backendDegraded
+		// The latency stays out of the message, which would otherwise change with every
+		// check and re-emit the status; it is reported in LatencyMs.
+		status.Message = fmt.Sprintf("Ollama at %s is responding slowly. Answers may take longer than usual.", settings.OllamaURL)
+	default:
+		status.State = backendUp
+	}
+	return status
+}
+
+// runHealthMonitor polls the Ollama server until the app shuts down, checking again
+// at once when recheckHealth is called.
+func (a *App) runHealthMonitor() {
+	for {
+		status := a.probeBackend()
+		a.setBackendStatus(status)
+
+		interval := healthCheckInterval
+		if status.State == backendDown {
+			interval = healthCheckDownInterval
+		}
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-a.healthRecheck:
+		case <-time.After(interval):
+		}
+	}
+}
+
+// recheckHealth asks the health monitor to check the backend now, e.g. after the
+// settings changed or a request failed to connect.
+func (a *App) recheckHealth() {
+	select {
+	case a.healthRecheck <- struct{}{}:
+	default: // A check is already pending
+	}
+}
+
+// setBackendStatus records the latest check and tells the frontend about changes.
+func (a *App) setBackendStatus(status BackendStatus) {
+	a.healthMu.Lock()
+	previous := a.backendStatus
+	a.backendStatus = status
+	a.healthMu.Unlock()
+
+	if status.State != previous.State || status.Message != previous.Message {
+		log.Printf("Backend status changed from %s to %s. %s", previous.State, status.State, status.Message)
+		runtime.EventsEmit(a.ctx, "backendStatus", status)
+	}
+}
+
+// currentBackendStatus returns the result of the latest health check.
+func (a *App) currentBackendStatus() BackendStatus {
+	a.healthMu.Lock()
+	defer a.healthMu.Unlock()
+	return a.backendStatus
+}
+
+// GetBackendStatus is a Wails-bindable method returning the result of the latest
+// health check of the Ollama server.
+func (a *App) GetBackendStatus() BackendStatus {
+	return a.currentBackendStatus()
+}
+
+// checkBackendAvailable fails fast while the last health check found the server down,
+// so questions are rejected with a clear message instead of a connection error.
+func (a *App) checkBackendAvailable() error {
+	status := a.currentBackendStatus()
+	if status.State != backendDown {
+		return nil
+	}
+	a.recheckHealth() // It may be back already; the next question will know
+	return errors.New(status.Message)
+}
@@ -0,0 +1,654 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	vectorIndexFileName       = "vectorindex.json" // File name of the persisted HNSW graph, next to the vector store
+	vectorIndexHNSW           = "hnsw"             // Approximate nearest-neighbour search over an HNSW graph
+	vectorIndexExact          = "exact"            // Brute-force scan of every chunk; slow but exact, kept for verification
+	defaultHNSWM              = 16                 // Links per node on the upper layers; layer 0 keeps twice as many
+	defaultHNSWEfConstruction = 200                // Candidates considered when linking a new node
+	defaultHNSWEfSearch       = 64                 // Candidates considered per query
+	maxHNSWM                  = 64                 // Upper bound accepted by VectorIndexOptions validation
+	maxHNSWEf                 = 2000               // Upper bound for efConstruction and efSearch
+	quantizationNone          = "none"             // Graph distances on float32 vectors
+	quantizationInt8          = "int8"             // Graph distances on int8 codes; results are rescored with float32
+)
+
+// VectorIndexOptions selects how the nearest chunks to a query embedding are found.
+// Larger M and ef values improve recall at the cost of speed and memory.
+type VectorIndexOptions struct {
+	Type           string `json:"type"`           // "hnsw" or "exact"
+	M              int    `json:"m"`              // Links per node; changing it rebuilds the index
+	EfConstruction int    `json:"efConstruction"` // Build-time candidate list size; changing it rebuilds the index
+	EfSearch       int    `json:"efSearch"`       // Query-time candidate list size; applies immediately
+	// Quantization is "none" or "int8" and applies immediately. int8 codes make graph
+	// distances cheaper to compute; they are kept alongside the float32 vectors, which
+	// rescoring and exact search still need, so they cost memory rather than save it.
+	Quantization string `json:"quantization"`
+}
+
+// defaultVectorIndexOptions returns the index options used until the user changes them.
+func defaultVectorIndexOptions() VectorIndexOptions {
+	return VectorIndexOptions{
+		Type:           vectorIndexHNSW,
+		M:              defaultHNSWM,
+		EfConstruction: defaultHNSWEfConstruction,
+		EfSearch:       defaultHNSWEfSearch,
+		Quantization:   quantizationNone,
+	}
+}
+
+// validate checks that the options are usable.
+func (o VectorIndexOptions) validate() error {
+	if o.Type != vectorIndexHNSW && o.Type != vectorIndexExact {
+		return fmt.Errorf("index type %q must be %q or %q", o.Type, vectorIndexHNSW, vectorIndexExact)
+	}
+	if o.M < 2 || o.M > maxHNSWM {
+		return fmt.Errorf("M must be between 2 and %d", maxHNSWM)
+	}
+	if o.EfConstruction < o.M || o.EfConstruction > maxHNSWEf {
+		return fmt.Errorf("efConstruction must be between M and %d", maxHNSWEf)
+	}
+	if o.EfSearch < 1 || o.EfSearch > maxHNSWEf {
+		return fmt.Errorf("efSearch must be between 1 and %d", maxHNSWEf)
+	}
+	if o.Quantization != quantizationNone && o.Quantization != quantizationInt8 {
+		return fmt.Errorf("quantization %q must be %q or %q", o.Quantization, quantizationNone, quantizationInt8)
+	}
+	if o.Quantization == quantizationInt8 && o.Type != vectorIndexHNSW {
+		return fmt.Errorf("int8 quantization only applies to the %q index", vectorIndexHNSW)
+	}
+	return nil
+}
+
+// hnswPoint is a vector in the graph or a query.
+type hnswPoint struct {
+	vector    []float32  // Unit-length embedding, shared with the chunk
+	quantized int8Vector // int8 codes of vector when the index is quantized, in addition to vector
+}
+
+// hnswNode is one chunk in the graph.
+type hnswNode struct {
+	hnswPoint
+	level   int         // Highest layer the node is on
+	links   [][]int     // Neighbour chunk IDs per layer, 0 to level
+	inbound map[int]int // Nodes linking to this one, with the number of layers they do on
+}
+
+// newHNSWNode creates a node without links.
+func newHNSWNode(point hnswPoint, level int) *hnswNode {
+	return &hnswNode{hnswPoint: point, level: level, links: make([][]int, level+1), inbound: make(map[int]int)}
+}
+
+// dropInbound forgets one link from the node with the given ID.
+func (node *hnswNode) dropInbound(id int) {
+	if node.inbound[id]--; node.inbound[id] <= 0 {
+		delete(node.inbound, id)
+	}
+}
+
+// hnswCandidate is a node found during a search, with its distance to the query.
+type hnswCandidate struct {
+	id   int
+	dist float64 // 1 - cosine similarity
+}
+
+// hnswQueue is a heap of candidates, nearest first or, with farthestFirst, farthest first.
+type hnswQueue struct {
+	items         []hnswCandidate
+	farthestFirst bool
+}
+
+func (q *hnswQueue) Len() int { return len(q.items) }
+func (q *hnswQueue) Less(i, j int) bool {
+	if q.farthestFirst {
+		return q.items[i].dist > q.items[j].dist
+	}
+	return q.items[i].dist < q.items[j].dist
+}
+func (q *hnswQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+func (q *hnswQueue) Push(x any)    { q.items = append(q.items, x.(hnswCandidate)) }
+func (q *hnswQueue) Pop() any {
+	last := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return last
+}
+
+// hnswIndex is a Hierarchical Navigable Small World graph over chunk embeddings
+// (Malkov & Yashunin, 2016), keyed by chunk ID. Nodes are added and removed as files
+// are indexed, so the graph never needs a full rebuild unless its parameters change.
+// It is not safe for concurrent use; VectorStore guards it.
+type hnswIndex struct {
+	m              int
+	efConstruction int
+	efSearch       int
+	levelMult      float64 // Normalisation factor for random levels, 1/ln(M)
+	dims           int     // Embedding length; 0 until the first node is added
+	quantize       bool    // Compare int8 codes while walking the graph
+	nodes          map[int]*hnswNode
+	entry          int // Entry point, a node on the top layer
+	maxLevel       int
+}
+
+// newHNSWIndex creates an empty index.
+func newHNSWIndex(options VectorIndexOptions) *hnswIndex {
+	return &hnswIndex{
+		m:              options.M,
+		efConstruction: options.EfConstruction,
+		efSearch:       options.EfSearch,
+		levelMult:      1 / math.Log(float64(options.M)),
+		quantize:       options.Quantization == quantizationInt8,
+		nodes:          make(map[int]*hnswNode),
+	}
+}
+
+// randomLevel draws the top layer of a node from an exponential distribution. The draw
+// is a hash of the chunk ID (SplitMix64) rather than the next number of a generator,
+// so a node gets the same level whatever order chunks are inserted in, before and
+// after the graph is saved and loaded again.
+func (ix *hnswIndex) randomLevel(id int) int {
+	x := uint64(id) + 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	x ^= x >> 31
+	uniform := (float64(x>>11) + 0.5) / (1 << 53) // In (0, 1)
+	return int(math.Floor(-math.Log(uniform) * ix.levelMult))
+}
+
+// buildHNSWIndex creates an index over every chunk with an embedding.
+func buildHNSWIndex(options VectorIndexOptions, chunks []DocumentChunk) *hnswIndex {
+	ix := newHNSWIndex(options)
+	for _, chunk := range chunks {
+		ix.insert(chunk.ID, chunk.Embedding)
+	}
+	return ix
+}
+
+// point wraps a unit vector for comparison with the nodes of the graph.
+func (ix *hnswIndex) point(vector []float32) hnswPoint {
+	p := hnswPoint{vector: vector}
+	if ix.quantize {
+		p.quantized = quantizeInt8(vector)
+	}
+	return p
+}
+
+// setQuantize switches graph distances between float32 vectors and int8 codes.
+// The links stay valid either way, so the graph is not rebuilt.
+func (ix *hnswIndex) setQuantize(quantize bool) {
+	if quantize == ix.quantize {
+		return
+	}
+	ix.quantize = quantize
+	for _, node := range ix.nodes {
+		node.hnswPoint = ix.point(node.vector)
+	}
+}
+
+// distance returns 1 - cosine similarity of two points, from the int8 codes when the
+// index is quantized.
+func (ix *hnswIndex) distance(a, b hnswPoint) float64 {
+	if ix.quantize {
+		return 1 - float64(a.quantized.dot(b.quantized))
+	}
+	return 1 - float64(dotProduct(a.vector, b.vector))
+}
+
+// maxLinks returns how many neighbours a node keeps on a layer.
+func (ix *hnswIndex) maxLinks(layer int) int {
+	if layer == 0 {
+		return 2 * ix.m
+	}
+	return ix.m
+}
+
+// searchLayer returns up to ef nodes on a layer nearest to q, nearest first, starting
+// from the entry candidates.
+func (ix *hnswIndex) searchLayer(q hnswPoint, entries []hnswCandidate, ef, layer int) []hnswCandidate {
+	visited := make(map[int]bool, ef*4)
+	candidates := &hnswQueue{}
+	results := &hnswQueue{farthestFirst: true}
+	for _, entry := range entries {
+		visited[entry.id] = true
+		heap.Push(candidates, entry)
+		heap.Push(results, entry)
+		if results.Len() > ef {
+			heap.Pop(results)
+		}
+	}
+
+	for candidates.Len() > 0 {
+		current := heap.Pop(candidates).(hnswCandidate)
+		if results.Len() >= ef && current.dist > results.items[0].dist {
+			break // Every remaining candidate is farther than the worst result
+		}
+		node := ix.nodes[current.id]
+		if node == nil || layer >= len(node.links) {
+			continue
+		}
+		for _, id := range node.links[layer] {
+			if visited[id] {
+				continue
+			}
+			visited[id] = true
+			neighbour := ix.nodes[id]
+			if neighbour == nil {
+				continue
+			}
+			dist := ix.distance(q, neighbour.hnswPoint)
+			if results.Len() < ef || dist < results.items[0].dist {
+				heap.Push(candidates, hnswCandidate{id: id, dist: dist})
+				heap.Push(results, hnswCandidate{id: id, dist: dist})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	nearest := results.items
+	sort.Slice(nearest, func(i, j int) bool { return nearest[i].dist < nearest[j].dist })
+	return nearest
+}
+
+// selectNeighbours picks up to n links from candidates sorted nearest first. A candidate
+// closer to an already selected neighbour than to the base node is skipped, so links
+// spread in different directions; skipped candidates fill any remaining places.
+func (ix *hnswIndex) selectNeighbours(candidates []hnswCandidate, n int) []int {
+	selected := make([]int, 0, n)
+	var skipped []int
+	for _, candidate := range candidates {
+		if len(selected) == n {
+			break
+		}
+		point := ix.nodes[candidate.id].hnswPoint
+		diverse := true
+		for _, id := range selected {
+			if ix.distance(point, ix.nodes[id].hnswPoint) < candidate.dist {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			selected = append(selected, candidate.id)
+		} else {
+			skipped = append(skipped, candidate.id)
+		}
+	}
+	for _, id := range skipped {
+		if len(selected) == n {
+			break
+		}
+		selected = append(selected, id)
+	}
+	return selected
+}
+
+// setLinks replaces the links of node id on a layer, keeping the inbound links of its
+// old and new neighbours up to date.
+func (ix *hnswIndex) setLinks(id int, node *hnswNode, layer int, links []int) {
+	for _, old := range node.links[layer] {
+		if neighbour := ix.nodes[old]; neighbour != nil {
+			neighbour.dropInbound(id)
+		}
+	}
+	node.links[layer] = links
+	for _, link := range links {
+		ix.nodes[link].inbound[id]++
+	}
+}
+
+// relink replaces the links of node id on a layer with the best of the given chunk IDs.
+func (ix *hnswIndex) relink(id int, node *hnswNode, layer int, ids []int) {
+	candidates := make([]hnswCandidate, 0, len(ids))
+	for _, id := range ids {
+		if neighbour := ix.nodes[id]; neighbour != nil {
+			candidates = append(candidates, hnswCandidate{id: id, dist: ix.distance(node.hnswPoint, neighbour.hnswPoint)})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].dist < candidates[j].dist })
+	ix.setLinks(id, node, layer, ix.selectNeighbours(candidates, ix.maxLinks(layer)))
+}
+
+// insert adds a unit-length chunk embedding to the graph, replacing an earlier one with
+// the same ID. Empty vectors and vectors of another length than the indexed ones are skipped.
+func (ix *hnswIndex) insert(id int, vector []float32) {
+	if len(vector) == 0 {
+		return
+	}
+	if ix.dims != 0 && len(vector) != ix.dims {
+		log.Printf("Not indexing chunk %d: embedding has %d dimensions, index has %d.", id, len(vector), ix.dims)
+		return
+	}
+	if _, ok := ix.nodes[id]; ok {
+		ix.remove([]int{id})
+	}
+
+	level := ix.randomLevel(id)
+	node := newHNSWNode(ix.point(vector), level)
+	if len(ix.nodes) == 0 {
+		ix.nodes[id] = node
+		ix.dims = len(vector)
+		ix.entry, ix.maxLevel = id, level
+		return
+	}
+
+	// Descend greedily to the node's top layer, then link it on every layer below.
+	entries := []hnswCandidate{{id: ix.entry, dist: ix.distance(node.hnswPoint, ix.nodes[ix.entry].hnswPoint)}}
+	for layer := ix.maxLevel; layer > level; layer-- {
+		entries = ix.searchLayer(node.hnswPoint, entries, 1, layer)
+	}
+	ix.nodes[id] = node
+	for layer := min(level, ix.maxLevel); layer >= 0; layer-- {
+		candidates := ix.searchLayer(node.hnswPoint, entries, ix.efConstruction, layer)
+		ix.setLinks(id, node, layer, ix.selectNeighbours(candidates, ix.m))
+		for _, neighbourID := range node.links[layer] {
+			neighbour := ix.nodes[neighbourID]
+			neighbour.links[layer] = append(neighbour.links[layer], id)
+			node.inbound[neighbourID]++
+			if len(neighbour.links[layer]) > ix.maxLinks(layer) {
+				ix.relink(neighbourID, neighbour, layer, neighbour.links[layer])
+			}
+		}
+		entries = candidates
+	}
+	if level > ix.maxLevel {
+		ix.entry, ix.maxLevel = id, level
+	}
+}
+
+// remove deletes chunks from the graph. Nodes that linked to a removed node are
+// relinked to the best of their remaining neighbours and the removed node's
+// neighbours, so the graph stays navigable without a rebuild. Only those nodes are
+// visited, found through the inbound links of the removed ones.
+func (ix *hnswIndex) remove(ids []int) {
+	removed := make(map[int]*hnswNode, len(ids))
+	for _, id := range ids {
+		if node, ok := ix.nodes[id]; ok {
+			removed[id] = node
+			delete(ix.nodes, id)
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+	if len(ix.nodes) == 0 {
+		ix.dims, ix.entry, ix.maxLevel = 0, 0, 0
+		return
+	}
+
+	affected := make(map[int]bool)
+	for id, node := range removed {
+		for _, links := range node.links {
+			for _, link := range links {
+				if neighbour := ix.nodes[link]; neighbour != nil {
+					neighbour.dropInbound(id)
+				}
+			}
+		}
+		for from := range node.inbound {
+			if removed[from] == nil {
+				affected[from] = true
+			}
+		}
+	}
+	for id := range affected {
+		node := ix.nodes[id]
+		for layer, links := range node.links {
+			candidates := make([]int, 0, len(links))
+			lost := false
+			for _, link := range links {
+				gone, ok := removed[link]
+				if !ok {
+					candidates = append(candidates, link)
+					continue
+				}
+				lost = true
+				if layer < len(gone.links) {
+					for _, twoHop := range gone.links[layer] {
+						if twoHop != id && removed[twoHop] == nil && !containsInt(candidates, twoHop) {
+							candidates = append(candidates, twoHop)
+						}
+					}
+				}
+			}
+			if lost {
+				ix.relink(id, node, layer, candidates)
+			}
+		}
+	}
+
+	if _, ok := removed[ix.entry]; ok {
+		// Rare: only the nodes of the top layer are ever chosen as entry point
+		ix.maxLevel = -1
+		for id, node := range ix.nodes {
+			if node.level > ix.maxLevel || (node.level == ix.maxLevel && id < ix.entry) {
+				ix.entry, ix.maxLevel = id, node.level
+			}
+		}
+	}
+}
+
+// containsInt reports whether ids contains id.
+func containsInt(ids []int, id int) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
+
+// search returns up to k chunks nearest to a unit-length query, nearest first. In a
+// quantized index the candidates are rescored with their float32 vectors, so the
+// returned distances are exact.
+func (ix *hnswIndex) search(query []float32, k int) []hnswCandidate {
+	if len(ix.nodes) == 0 || len(query) == 0 || len(query) != ix.dims {
+		return nil
+	}
+	q := ix.point(query)
+	entries := []hnswCandidate{{id: ix.entry, dist: ix.distance(q, ix.nodes[ix.entry].hnswPoint)}}
+	for layer := ix.maxLevel; layer > 0; layer-- {
+		entries = ix.searchLayer(q, entries, 1, layer)
+	}
+	ef := max(ix.efSearch, k)
+	if ix.quantize {
+		ef = max(ef, k*int8RescoreFactor) // Room for codes to misorder the true top k
+	}
+	nearest := ix.searchLayer(q, entries, ef, 0)
+	if ix.quantize {
+		for i := range nearest {
+			nearest[i].dist = 1 - float64(dotProduct(query, ix.nodes[nearest[i].id].vector))
+		}
+		sort.Slice(nearest, func(i, j int) bool { return nearest[i].dist < nearest[j].dist })
+	}
+	return nearest[:min(k, len(nearest))]
+}
+
+// hnswFile is the on-disk form of an index. Vectors are not stored; they are taken
+// from the vector store when the index is loaded.
+type hnswFile struct {
+	M              int            `json:"m"`
+	EfConstruction int            `json:"ef_construction"`
+	EmbeddingModel string         `json:"embedding_model"` // Guards against reusing a graph over re-embedded chunks
+	Dims           int            `json:"dims"`
+	Entry          int            `json:"entry"`
+	MaxLevel       int            `json:"max_level"`
+	Nodes          []hnswFileNode `json:"nodes"`
+}
+
+// hnswFileNode is the on-disk form of a node.
+type hnswFileNode struct {
+	ID    int     `json:"id"`
+	Level int     `json:"level"`
+	Links [][]int `json:"links"`
+}
+
+// save writes the graph to path atomically.
+func (ix *hnswIndex) save(path, embeddingModel string) error {
+	file := hnswFile{
+		M:              ix.m,
+		EfConstruction: ix.efConstruction,
+		EmbeddingModel: embeddingModel,
+		Dims:           ix.dims,
+		Entry:          ix.entry,
+		MaxLevel:       ix.maxLevel,
+		Nodes:          make([]hnswFileNode, 0, len(ix.nodes)),
+	}
+	for id, node := range ix.nodes {
+		file.Nodes = append(file.Nodes, hnswFileNode{ID: id, Level: node.level, Links: node.links})
+	}
+	sort.Slice(file.Nodes, func(i, j int) bool { return file.Nodes[i].ID < file.Nodes[j].ID })
+	data, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("could not encode vector index: %w", err)
+	}
+	return writeFileAtomic(path, data)
+}
+
+// errVectorIndexMismatch reports a persisted index that does not fit the store or
+// the options, so it has to be rebuilt.
+var errVectorIndexMismatch = errors.New("vector index does not match the stored chunks")
+
+// loadHNSWIndex reads the graph saved at path and attaches the chunk embeddings to it.
+// It fails with errVectorIndexMismatch unless the graph was built with the same
+// parameters and embedding model over exactly the given chunks.
+func loadHNSWIndex(path string, options VectorIndexOptions, embeddingModel string, chunks []DocumentChunk) (*hnswIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read vector index %s: %w", path, err)
+	}
+	var file hnswFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("could not parse vector index %s: %w", path, err)
+	}
+	if file.M != options.M || file.EfConstruction != options.EfConstruction || file.EmbeddingModel != embeddingModel {
+		return nil, fmt.Errorf("%w: built with different parameters or embedding model", errVectorIndexMismatch)
+	}
+
+	ix := newHNSWIndex(options)
+	ix.dims, ix.entry, ix.maxLevel = file.Dims, file.Entry, file.MaxLevel
+	vectors := make(map[int][]float32, len(chunks))
+	for _, chunk := range chunks {
+		if len(chunk.Embedding) > 0 && len(chunk.Embedding) == file.Dims {
+			vectors[chunk.ID] = chunk.Embedding
+		}
+	}
+	if len(vectors) != len(file.Nodes) {
+		return nil, fmt.Errorf("%w: %d nodes for %d embedded chunks", errVectorIndexMismatch, len(file.Nodes), len(vectors))
+	}
+	for _, fileNode := range file.Nodes {
+		vector, ok := vectors[fileNode.ID]
+		if !ok || len(fileNode.Links) != fileNode.Level+1 {
+			return nil, fmt.Errorf("%w: unknown or malformed node %d", errVectorIndexMismatch, fileNode.ID)
+		}
+		node := newHNSWNode(ix.point(vector), fileNode.Level)
+		node.links = fileNode.Links
+		ix.nodes[fileNode.ID] = node
+	}
+	for id, node := range ix.nodes {
+		for _, links := range node.links {
+			for _, link := range links {
+				neighbour := ix.nodes[link]
+				if neighbour == nil {
+					return nil, fmt.Errorf("%w: node %d links to unknown node %d", errVectorIndexMismatch, id, link)
+				}
+				neighbour.inbound[id]++
+			}
+		}
+	}
+	if _, ok := ix.nodes[ix.entry]; !ok && len(ix.nodes) > 0 {
+		return nil, fmt.Errorf("%w: missing entry point %d", errVectorIndexMismatch, ix.entry)
+	}
+	return ix, nil
+}
+
+// VectorIndexReport compares the HNSW index with an exact search over the same chunks.
+type VectorIndexReport struct {
+	Nodes          int     `json:"nodes"`          // Chunks in the index
+	Queries        int     `json:"queries"`        // Stored embeddings used as test queries
+	K              int     `json:"k"`              // Neighbours compared per query
+	Recall         float64 `json:"recall"`         // Share of the exact top K the index also returned
+	IndexMicros    float64 `json:"indexMicros"`    // Average index search time per query
+	ExactMicros    float64 `json:"exactMicros"`    // Average exact search time per query
+	EfSearch       int     `json:"efSearch"`       // Query-time candidate list size in effect
+	EfConstruction int     `json:"efConstruction"` // Build-time candidate list size of the graph
+	M              int     `json:"m"`
+}
+
+// VerifyIndex measures the recall of the HNSW index against an exact search, using
+// the embeddings of up to queries evenly spread chunks as queries.
+func (s *VectorStore) VerifyIndex(queries, k int) (VectorIndexReport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.index == nil {
+		return VectorIndexReport{}, errors.New("the vector index is disabled; every search is already exact")
+	}
+	if len(s.index.nodes) == 0 {
+		return VectorIndexReport{}, errors.New("the vector index is empty; load documents first")
+	}
+
+	report := VectorIndexReport{Nodes: len(s.index.nodes), K: k, EfSearch: s.index.efSearch, EfConstruction: s.index.efConstruction, M: s.index.m}
+	step := max(1, len(s.chunks)/queries)
+	var indexTime, exactTime time.Duration
+	found, expected := 0, 0
+	for i := 0; i < len(s.chunks) && report.Queries < queries; i += step {
+		query := s.chunks[i].Embedding
+		if len(query) == 0 {
+			continue
+		}
+		report.Queries++
+
+		start := time.Now()
+		approximate := s.index.search(query, k)
+		indexTime += time.Since(start)
+		start = time.Now()
+		exact := s.exactVectorChunksLocked(query, k, chunkFilter{})
+		exactTime += time.Since(start)
+
+		returned := make(map[int]bool, len(approximate))
+		for _, candidate := range approximate {
+			returned[candidate.id] = true
+		}
+		for _, chunk := range exact {
+			expected++
+			if returned[chunk.ID] {
+				found++
+			}
+		}
+	}
+	if report.Queries == 0 {
+		return report, errors.New("no chunk has an embedding to query with")
+	}
+	report.Recall = float64(found) / float64(max(expected, 1))
+	report.IndexMicros = float64(indexTime.Microseconds()) / float64(report.Queries)
+	report.ExactMicros = float64(exactTime.Microseconds()) / float64(report.Queries)
+	return report, nil
+}
+
+// VerifyVectorIndex is a Wails-bindable method that checks how many of the true nearest
+// chunks the HNSW index finds, and how much faster it is than an exact search, so
+// M and ef values can be tuned against the loaded documents.
+func (a *App) VerifyVectorIndex(queries int) (VectorIndexReport, error) {
+	if queries < 1 {
+		queries = 100
+	}
+	report, err := a.store.VerifyIndex(queries, a.currentSettings().Retrieval.TopN)
+	if err != nil {
+		return report, fmt.Errorf("could not verify vector index: %w", err)
+	}
+	log.Printf("Vector index recall@%d over %d queries: %.3f (index %.0fµs, exact %.0fµs per query)",
+		report.K, report.Queries, report.Recall, report.IndexMicros, report.ExactMicros)
+	return report, nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+// newHNSWTestStore returns a memory store holding one chunk per random unit vector.
+func newHNSWTestStore(rng *rand.Rand, n, dims int) *VectorStore {
+	store := newMemoryVectorStore()
+	for i, vector := range randomUnitVectors(rng, n, dims) {
+		store.ReplaceFile(FileRecord{SourceFile: fmt.Sprintf("%d.txt", i)}, []DocumentChunk{{Text: "chunk", Embedding: vector}})
+	}
+	return store
+}
+
+// removeHNSWTestChunks removes chunks from both the index and the store, so exact
+// searches of the store give the expected results of the index.
+func removeHNSWTestChunks(ix *hnswIndex, store *VectorStore, ids []int) {
+	ix.remove(ids)
+	for _, id := range ids {
+		if pos, ok := store.positions[id]; ok {
+			store.RemoveFile(store.chunks[pos].SourceFile)
+		}
+	}
+}
+
+// hnswRecall returns the share of the exact top k that the index also returns, over
+// the given queries.
+func hnswRecall(ix *hnswIndex, store *VectorStore, queries [][]float32, k int) float64 {
+	found, total := 0, 0
+	for _, query := range queries {
+		approx := make(map[int]bool)
+		for _, candidate := range ix.search(query, k) {
+			approx[candidate.id] = true
+		}
+		for _, chunk := range store.exactVectorChunksLocked(query, k, chunkFilter{}) {
+			total++
+			if approx[chunk.ID] {
+				found++
+			}
+		}
+	}
+	return float64(found) / float64(total)
+}
+
+// checkHNSWGraph fails the test unless every link points to a node of the graph, the
+// inbound links of each node match the links to it, and the entry point is on the top
+// layer.
+func checkHNSWGraph(t *testing.T, ix *hnswIndex) {
+	t.Helper()
+	inbound := make(map[int]map[int]int)
+	for id, node := range ix.nodes {
+		if len(node.links) != node.level+1 {
+			t.Fatalf("node %d on level %d has %d link layers", id, node.level, len(node.links))
+		}
+		for layer, links := range node.links {
+			for _, link := range links {
+				neighbour := ix.nodes[link]
+				if neighbour == nil {
+					t.Fatalf("node %d links to missing node %d on layer %d", id, link, layer)
+				}
+				if neighbour.level < layer {
+					t.Fatalf("node %d links to node %d on layer %d above its level %d", id, link, layer, neighbour.level)
+				}
+				if inbound[link] == nil {
+					inbound[link] = make(map[int]int)
+				}
+				inbound[link][id]++
+			}
+		}
+	}
+	for id, node := range ix.nodes {
+		if len(node.inbound) != len(inbound[id]) {
+			t.Fatalf("node %d has inbound links %v, want %v", id, node.inbound, inbound[id])
+		}
+		for from, count := range inbound[id] {
+			if node.inbound[from] != count {
+				t.Fatalf("node %d has inbound links %v, want %v", id, node.inbound, inbound[id])
+			}
+		}
+	}
+	if len(ix.nodes) > 0 {
+		if entry := ix.nodes[ix.entry]; entry == nil || entry.level != ix.maxLevel {
+			t.Fatalf("entry point %d is missing or not on the top layer %d", ix.entry, ix.maxLevel)
+		}
+	}
+}
+
+func TestHNSWRecall(t *testing.T) {
+	tests := []struct {
+		name       string
+		m          int
+		ef         int
+		quantize   bool
+		wantRecall float64
+	}{
+		{"default", defaultHNSWM, defaultHNSWEfSearch, false, 0.95},
+		{"small M", 4, defaultHNSWEfSearch, false, 0.85},
+		{"int8", defaultHNSWM, defaultHNSWEfSearch, true, 0.95},
+		{"small ef", defaultHNSWM, 10, false, 0.8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(1))
+			store := newHNSWTestStore(rng, 1000, 32)
+			options := defaultVectorIndexOptions()
+			options.M, options.EfSearch = tt.m, tt.ef
+			if tt.quantize {
+				options.Quantization = quantizationInt8
+			}
+			ix := buildHNSWIndex(options, store.chunks)
+			checkHNSWGraph(t, ix)
+
+			if got := hnswRecall(ix, store, randomUnitVectors(rng, 50, 32), 10); got < tt.wantRecall {
+				t.Errorf("recall@10 = %.3f, want at least %.2f", got, tt.wantRecall)
+			}
+		})
+	}
+}
+
+func TestHNSWRemove(t *testing.T) {
+	tests := []struct {
+		name   string
+		remove func(ix *hnswIndex) []int
+	}{
+		{"none", func(ix *hnswIndex) []int { return nil }},
+		{"unknown", func(ix *hnswIndex) []int { return []int{-1} }},
+		{"entry point", func(ix *hnswIndex) []int { return []int{ix.entry} }},
+		{"entry point's neighbours", func(ix *hnswIndex) []int { return append([]int{ix.entry}, ix.nodes[ix.entry].links[0]...) }},
+		{"every third", func(ix *hnswIndex) []int {
+			var ids []int
+			for id := range ix.nodes {
+				if id%3 == 0 {
+					ids = append(ids, id)
+				}
+			}
+			return ids
+		}},
+		{"all", func(ix *hnswIndex) []int {
+			var ids []int
+			for id := range ix.nodes {
+				ids = append(ids, id)
+			}
+			return ids
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(2))
+			store := newHNSWTestStore(rng, 600, 32)
+			ix := buildHNSWIndex(defaultVectorIndexOptions(), store.chunks)
+			ids := tt.remove(ix)
+			removeHNSWTestChunks(ix, store, ids)
+			checkHNSWGraph(t, ix)
+
+			if len(ix.nodes) != len(store.chunks) {
+				t.Fatalf("index has %d nodes for %d chunks", len(ix.nodes), len(store.chunks))
+			}
+			if len(ix.nodes) == 0 {
+				if got := ix.search(randomUnitVectors(rng, 1, 32)[0], 10); len(got) != 0 {
+					t.Errorf("empty index returned %v", got)
+				}
+				return
+			}
+			if got := hnswRecall(ix, store, randomUnitVectors(rng, 50, 32), 10); got < 0.9 {
+				t.Errorf("recall@10 after removing %d nodes = %.3f, want at least 0.9", len(ids), got)
+			}
+		})
+	}
+}
+
+func TestHNSWLevelsIgnoreInsertionOrder(t *testing.T) {
+	store := newHNSWTestStore(rand.New(rand.NewSource(3)), 300, 16)
+	forward := buildHNSWIndex(defaultVectorIndexOptions(), store.chunks)
+	reversed := newHNSWIndex(defaultVectorIndexOptions())
+	for i := len(store.chunks) - 1; i >= 0; i-- {
+		reversed.insert(store.chunks[i].ID, store.chunks[i].Embedding)
+	}
+	for id, node := range forward.nodes {
+		if got := reversed.nodes[id].level; got != node.level {
+			t.Fatalf("node %d is on level %d inserted forward but %d inserted in reverse", id, node.level, got)
+		}
+	}
+}
+
+func TestHNSWSaveLoad(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	store := newHNSWTestStore(rng, 500, 32)
+	options := defaultVectorIndexOptions()
+	saved := buildHNSWIndex(options, store.chunks)
+	removeHNSWTestChunks(saved, store, []int{store.chunks[0].ID, saved.entry})
+	path := filepath.Join(t.TempDir(), vectorIndexFileName)
+	if err := saved.save(path, "nomic-embed-text"); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		options func(o *VectorIndexOptions)
+		model   string
+		chunks  []DocumentChunk
+		wantErr bool
+	}{
+		{"round trip", func(o *VectorIndexOptions) {}, "nomic-embed-text", store.chunks, false},
+		{"other efSearch and quantization", func(o *VectorIndexOptions) { o.EfSearch, o.Quantization = 10, quantizationInt8 }, "nomic-embed-text", store.chunks, false},
+		{"other M", func(o *VectorIndexOptions) { o.M++ }, "nomic-embed-text", store.chunks, true},
+		{"other efConstruction", func(o *VectorIndexOptions) { o.EfConstruction++ }, "nomic-embed-text", store.chunks, true},
+		{"other model", func(o *VectorIndexOptions) {}, "mxbai-embed-large", store.chunks, true},
+		{"missing chunk", func(o *VectorIndexOptions) {}, "nomic-embed-text", store.chunks[1:], true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadOptions := options
+			tt.options(&loadOptions)
+			loaded, err := loadHNSWIndex(path, loadOptions, tt.model, tt.chunks)
+			if tt.wantErr {
+				if !errors.Is(err, errVectorIndexMismatch) {
+					t.Fatalf("loadHNSWIndex() error = %v, want errVectorIndexMismatch", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadHNSWIndex() error = %v", err)
+			}
+			checkHNSWGraph(t, loaded)
+			if loaded.entry != saved.entry || loaded.maxLevel != saved.maxLevel || len(loaded.nodes) != len(saved.nodes) {
+				t.Fatalf("loaded entry %d, top layer %d, %d nodes; saved %d, %d, %d",
+					loaded.entry, loaded.maxLevel, len(loaded.nodes), saved.entry, saved.maxLevel, len(saved.nodes))
+			}
+			if got := hnswRecall(loaded, store, randomUnitVectors(rng, 50, 32), 10); got < 0.8 {
+				t.Errorf("recall@10 after loading = %.3f, want at least 0.8", got)
+			}
+
+			// The loaded graph keeps growing as the saved one would
+			vector := randomUnitVectors(rng, 1, 32)[0]
+			saved.insert(1_000_000, vector)
+			loaded.insert(1_000_000, vector)
+			checkHNSWGraph(t, loaded)
+			if got, want := loaded.nodes[1_000_000].level, saved.nodes[1_000_000].level; got != want {
+				t.Errorf("node inserted after loading is on level %d, want %d as before saving", got, want)
+			}
+			saved.remove([]int{1_000_000})
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	bm25K1 = 1.2  // Term frequency saturation
+	bm25B  = 0.75 // Document length normalisation
+)
+
+// keywordPosting records how often a term occurs in one chunk.
+type keywordPosting struct {
+	chunkID int
+	freq    int
+}
+
+// keywordMatch is a chunk found by keyword search.
+type keywordMatch struct {
+	chunkID int
+	score   float64 // BM25 score normalised to 0..1; see keywordIndex.search
+}
+
+// keywordIndex is an inverted index over chunk texts scored with BM25. It catches
+// exact tokens such as drug names, ICD codes ("E11.9") and lab abbreviations ("HbA1c")
+// that embeddings tend to blur. It is not safe for concurrent use; VectorStore guards it.
+type keywordIndex struct {
+	postings    map[string][]keywordPosting // Chunks containing each term
+	lengths     map[int]int                 // Number of terms per chunk, keyed by chunk ID
+	totalLength int
+}
+
+// newKeywordIndex builds an index over chunks.
+func newKeywordIndex(chunks []DocumentChunk) *keywordIndex {
+	ix := &keywordIndex{
+		postings: make(map[string][]keywordPosting),
+		lengths:  make(map[int]int),
+	}
+	for _, chunk := range chunks {
+		ix.add(chunk)
+	}
+	return ix
+}
+
+// keywordTerms splits text into lower-case index terms. Letters and digits form terms;
+// '.', '-' and '/' between two of them are kept, so "E11.9" and "T-cell" stay whole.
+// The parts of such compound terms are emitted as well, so "E11" still matches "E11.9".
+func keywordTerms(text string) []string {
+	runes := []rune(strings.ToLower(text))
+	isWord := func(i int) bool {
+		return i >= 0 && i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]))
+	}
+	var terms []string
+	for i := 0; i < len(runes); {
+		if !isWord(i) {
+			i++
+			continue
+		}
+		start, partStart := i, i
+		var parts []string
+		for i < len(runes) {
+			if isWord(i) {
+				i++
+				continue
+			}
+			if strings.ContainsRune(".-/", runes[i]) && isWord(i-1) && isWord(i+1) {
+				parts = append(parts, string(runes[partStart:i]))
+				i++
+				partStart = i
+				continue
+			}
+			break
+		}
+		terms = append(terms, string(runes[start:i]))
+		if len(parts) > 0 {
+			terms = append(terms, append(parts, string(runes[partStart:i]))...)
+		}
+	}
+	return terms
+}
+
+// termFrequencies counts the terms of a chunk text.
+func termFrequencies(text string) (map[string]int, int) {
+	terms := keywordTerms(text)
+	freqs := make(map[string]int, len(terms))
+	for _, term := range terms {
+		freqs[term]++
+	}
+	return freqs, len(terms)
+}
+
+// add indexes a chunk.
+func (ix *keywordIndex) add(chunk DocumentChunk) {
+	freqs, length := termFrequencies(chunk.Text)
+	for term, freq := range freqs {
+		ix.postings[term] = append(ix.postings[term], keywordPosting{chunkID: chunk.ID, freq: freq})
+	}
+	ix.lengths[chunk.ID] = length
+	ix.totalLength += length
+}
+
+// remove drops chunks from the index.
+func (ix *keywordIndex) remove(chunks []DocumentChunk) {
+	removed := make(map[int]bool, len(chunks))
+	terms := make(map[string]bool)
+	for _, chunk := range chunks {
+		if _, ok := ix.lengths[chunk.ID]; !ok {
+			continue
+		}
+		removed[chunk.ID] = true
+		ix.totalLength -= ix.lengths[chunk.ID]
+		delete(ix.lengths, chunk.ID)
+		for _, term := range keywordTerms(chunk.Text) {
+			terms[term] = true
+		}
+	}
+	for term := range terms {
+		kept := ix.postings[term][:0]
+		for _, posting := range ix.postings[term] {
+			if !removed[posting.chunkID] {
+				kept = append(kept, posting)
+			}
+		}
+		if len(kept) == 0 {
+			delete(ix.postings, term)
+		} else {
+			ix.postings[term] = kept
+		}
+	}
+}
+
+// search returns the topN chunks with the highest BM25 score for query, best first.
+// Scores are divided by the highest score any chunk could reach for the query terms
+// found in the index, so they lie between 0 and 1 and a chunk only matching common
+// words scores low. Query terms missing from the index are left out of that maximum:
+// no chunk can match them, and a question's filler words ("what about ...") would
+// otherwise push every score below the minimum. If accept is not nil, only chunks it
+// accepts are scored.
+func (ix *keywordIndex) search(query string, topN int, accept func(chunkID int) bool) []keywordMatch {
+	if len(ix.lengths) == 0 || topN <= 0 {
+		return nil
+	}
+	queryTerms, _ := termFrequencies(query)
+	n := float64(len(ix.lengths))
+	avgLength := float64(ix.totalLength) / n
+	scores := make(map[int]float64)
+	maxScore := 0.0
+	for term := range queryTerms {
+		postings := ix.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		maxScore += idf * (bm25K1 + 1)
+		for _, posting := range postings {
+			if accept != nil && !accept(posting.chunkID) {
+				continue
+			}
+			tf := float64(posting.freq)
+			norm := 1 - bm25B + bm25B*float64(ix.lengths[posting.chunkID])/avgLength
+			scores[posting.chunkID] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+	if len(scores) == 0 || maxScore == 0 {
+		return nil
+	}
+
+	matches := make([]keywordMatch, 0, len(scores))
+	for chunkID, score := range scores {
+		matches = append(matches, keywordMatch{chunkID: chunkID, score: score / maxScore})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].chunkID < matches[j].chunkID
+	})
+	return matches[:min(topN, len(matches))]
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// DataLoadEvent is the payload of "dataLoadEvent", emitted while a document load
+// runs in the background.
+type DataLoadEvent struct {
+	Status         string       `json:"status"` // "started", "progress", "done", "cancelled" or "error"
+	Message        string       `json:"message,omitempty"`
+	Error          string       `json:"error,omitempty"`       // Latest per-file error, or the error that ended the load
+	CurrentFile    string       `json:"currentFile,omitempty"` // File being processed
+	FilesDone      int          `json:"filesDone"`
+	FilesTotal     int          `json:"filesTotal"`
+	ChunksEmbedded int          `json:"chunksEmbedded"`
+	ChunksTotal    int          `json:"chunksTotal"` // Chunks to embed; known once all changed files are extracted
+	ErrorCount     int          `json:"errorCount"`
+	EtaSeconds     float64      `json:"etaSeconds,omitempty"` // Estimated time left, from the bytes read or chunks embedded so far
+	Summary        *LoadSummary `json:"summary,omitempty"`    // Set on the final event
+}
+
+// loadProgress tracks a running load and emits DataLoadEvent updates.
+type loadProgress struct {
+	ctx        context.Context
+	event      DataLoadEvent
+	startTime  time.Time
+	bytesDone  int64 // Bytes of the files checked and extracted so far
+	bytesTotal int64
+}
+
+// emit sends the current progress with the given status.
+func (p *loadProgress) emit(status string) {
+	p.event.Status = status
+	p.event.EtaSeconds = 0
+	elapsed := time.Since(p.startTime).Seconds()
+	if p.event.ChunksTotal > 0 {
+		if done := p.event.ChunksEmbedded; done > 0 && p.event.ChunksTotal > done {
+			p.event.EtaSeconds = elapsed * float64(p.event.ChunksTotal-done) / float64(done)
+		}
+	} else if p.bytesDone > 0 && p.bytesTotal > p.bytesDone {
+		p.event.EtaSeconds = elapsed * float64(p.bytesTotal-p.bytesDone) / float64(p.bytesDone)
+	}
+	runtime.EventsEmit(p.ctx, "dataLoadEvent", p.event)
+}
+
+// fileFailed records a per-file error and reports it.
+func (p *loadProgress) fileFailed(sourceFile string, err error) {
+	p.event.ErrorCount++
+	p.event.Error = fmt.Sprintf("%s: %v", sourceFile, err)
+	p.emit("progress")
+}
+
+// LoadSummary reports what a LoadPersonalData run changed in the vector store.
+type LoadSummary struct {
+	Directory    string        `json:"directory"`
+	Added        []string      `json:"added"`     // Files indexed for the first time
+	Updated      []string      `json:"updated"`   // Files whose content changed and were re-indexed
+	Removed      []string      `json:"removed"`   // Files no longer present whose chunks were dropped
+	Unchanged    []string      `json:"unchanged"` // Files skipped because their content did not change
+	Failed       []string      `json:"failed"`    // Files that could not be read or embedded; previous chunks are kept
+	Skipped      []SkippedFile `json:"skipped"`   // Included files no registered extractor can handle
+	ChunksLoaded int           `json:"chunksLoaded"`
+	Message      string        `json:"message"`
+}
+
+// newLoadSummary creates a LoadSummary with empty (non-nil) file lists,
+// so the frontend always receives arrays.
+func newLoadSummary(directory string) LoadSummary {
+	return LoadSummary{
+		Directory: directory,
+		Added:     []string{},
+		Updated:   []string{},
+		Removed:   []string{},
+		Unchanged: []string{},
+		Failed:    []string{},
+		Skipped:   []SkippedFile{},
+	}
+}
+
+// hashContent returns the hex-encoded SHA-256 of content.
+func hashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// SkippedFile is a file the loader did not index, with the reason why.
+type SkippedFile struct {
+	File   string `json:"file"`
+	Reason string `json:"reason"`
+}
+
+// pendingFile is a new or changed source file whose chunks are waiting for embeddings.
+type pendingFile struct {
+	file      documentFile
+	record    FileRecord
+	chunks    []DocumentChunk // Text and page are set; embeddings are filled in as batches complete
+	firstText int             // Index of the file's first chunk in the job's flattened text list
+	remaining int             // Chunks whose batch has not finished yet
+	err       error           // First embedding error for this file
+}
+
+// runLoadJob incrementally indexes the files under directoryPath into the vector store.
+// Only new or changed files are chunked and embedded; files that disappeared are removed.
+// It runs in its own goroutine, started by LoadPersonalData, and reports through
+// "dataLoadEvent".
+//
+// Changed files are first extracted and chunked, then all their chunks are embedded in
+// batches by a pool of concurrent requests. Files are committed to the store in walk
+// order as soon as their chunks are embedded, so document IDs do not depend on which
+// batch finishes first. When ctx is cancelled the job keeps the files committed so far
+// and leaves the others untouched.
+func (a *App) runLoadJob(ctx context.Context, directoryPath string, options LoadOptions) {
+	progress := &loadProgress{ctx: a.ctx, startTime: time.Now()}
+	defer func() {
+		a.mu.Lock()
+		a.loadCancel = nil
+		a.mu.Unlock()
+	}()
+
+	progress.event.Message = fmt.Sprintf("Scanning %s...", directoryPath)
+	progress.emit("started")
+
+	documentFiles, err := walkDocuments(directoryPath, options)
+	if err != nil {
+		errMsg := fmt.Sprintf("error reading directory %s: %v", directoryPath, err)
+		log.Println(errMsg)
+		progress.event.Error = errMsg
+		progress.emit("error")
+		return
+	}
+	log.Printf("Found %d matching files under %s.", len(documentFiles), directoryPath)
+	progress.event.FilesTotal = len(documentFiles)
+	for _, file := range documentFiles {
+		progress.bytesTotal += file.Info.Size()
+	}
+
+	// Vectors from another embedding model can't be compared with new ones, so a stale
+	// index is rebuilt from scratch.
+	if embeddingModel := a.currentSettings().EmbeddingModel; a.store.EmbeddingModel() != embeddingModel {
+		if a.store.Len() > 0 {
+			log.Printf("Index was built with %s; re-embedding every file with %s.", a.store.EmbeddingModel(), embeddingModel)
+			a.store.Reset()
+		}
+		a.store.SetEmbeddingModel(embeddingModel)
+	}
+
+	summary := newLoadSummary(directoryPath)
+	previouslyIndexed := make(map[string]bool)
+	for _, name := range a.store.SourceFiles() {
+		previouslyIndexed[name] = true
+	}
+	seen := make(map[string]bool)
+
+	// Phase 1: find changed files and split them into chunks.
+	var pending []*pendingFile
+	var texts []string
+	var textOwner []int // Index in pending of the file each text belongs to
+	for _, file := range documentFiles {
+		if ctx.Err() != nil {
+			break
+		}
+		sourceFile := file.RelPath // Relative path, so same-named files in different folders don't collide
+		seen[sourceFile] = true
+		log.Printf("Processing file: %s", file.Path)
+		progress.event.CurrentFile = sourceFile
+		progress.emit("progress")
+
+		p, err := a.prepareFile(file, options)
+		progress.bytesDone += file.Info.Size()
+		switch {
+		case errors.Is(err, errUnsupportedFormat):
+			log.Printf("Skipping file %s: %v", file.Path, err)
+			delete(seen, sourceFile) // Drop chunks of a file that can no longer be extracted
+			summary.Skipped = append(summary.Skipped, SkippedFile{File: sourceFile, Reason: err.Error()})
+			progress.event.FilesDone++
+		case err != nil:
+			log.Printf("Error indexing file %s: %v. Skipping.", file.Path, err)
+			summary.Failed = append(summary.Failed, sourceFile)
+			progress.event.FilesDone++
+			progress.fileFailed(sourceFile, err)
+		case p == nil:
+			summary.Unchanged = append(summary.Unchanged, sourceFile)
+			progress.event.FilesDone++
+		default:
+			p.firstText = len(texts)
+			p.remaining = len(p.chunks)
+			for _, chunk := range p.chunks {
+				texts = append(texts, chunk.Text)
+				textOwner = append(textOwner, len(pending))
+			}
+			pending = append(pending, p)
+		}
+	}
+	progress.event.CurrentFile = ""
+
+	// Phase 2: embed all pending chunks and commit files in walk order.
+	commitFile := func(p *pendingFile) {
+		sourceFile := p.record.SourceFile
+		switch {
+		case errors.Is(p.err, context.Canceled):
+			log.Printf("Load cancelled before %s was fully embedded. Keeping its previous chunks.", p.file.Path)
+			return
+		case p.err != nil:
+			// Keep the previously indexed chunks rather than storing a partial file;
+			// the hash is not recorded, so the file is retried on the next load.
+			log.Printf("Error embedding chunks of %s: %v. Skipping.", p.file.Path, p.err)
+			summary.Failed = append(summary.Failed, sourceFile)
+			progress.event.FilesDone++
+			progress.fileFailed(sourceFile, p.err)
+			return
+		}
+		added := a.store.ReplaceFile(p.record, p.chunks)
+		summary.ChunksLoaded += len(added)
+		if previouslyIndexed[sourceFile] {
+			summary.Updated = append(summary.Updated, sourceFile)
+		} else {
+			summary.Added = append(summary.Added, sourceFile)
+		}
+		progress.event.FilesDone++
+		progress.event.CurrentFile = sourceFile
+		progress.emit("progress")
+	}
+	nextCommit := 0
+	commitReady := func() {
+		for nextCommit < len(pending) && pending[nextCommit].remaining == 0 {
+			commitFile(pending[nextCommit])
+			nextCommit++
+		}
+	}
+	commitReady() // Files without any non-empty chunk
+
+	if len(texts) > 0 && ctx.Err() == nil {
+		log.Printf("Embedding %d chunks from %d files (batch size %d, concurrency %d).", len(texts), len(pending), options.EmbedBatchSize, options.EmbedConcurrency)
+		progress.event.ChunksTotal = len(texts)
+		progress.startTime = time.Now() // ETA from here on is based on embedding throughput
+		a.embedConcurrently(ctx, texts, options.EmbedBatchSize, options.EmbedConcurrency, func(batch embedBatchResult) {
+			for i := 0; i < batch.count; i++ {
+				p := pending[textOwner[batch.start+i]]
+				if batch.err != nil {
+					if p.err == nil {
+						p.err = batch.err
+					}
+				} else {
+					p.chunks[batch.start+i-p.firstText].Embedding = unitEmbedding(batch.embeddings[i])
+					progress.event.ChunksEmbedded++
+				}
+				p.remaining--
+			}
+			progress.emit("progress")
+			commitReady()
+		})
+	}
+	for ; nextCommit < len(pending); nextCommit++ {
+		// Only reached when cancelled before the embedding phase started.
+		pending[nextCommit].err = context.Canceled
+		commitFile(pending[nextCommit])
+	}
+	progress.event.CurrentFile = ""
+
+	cancelled := ctx.Err() != nil
+	if !cancelled {
+		// Drop chunks of files that are no longer in the directory. Skipped after a
+		// cancellation, since files not reached yet were never marked as seen.
+		for name := range previouslyIndexed {
+			if seen[name] {
+				continue
+			}
+			removedChunks := a.store.RemoveFile(name)
+			log.Printf("File %s no longer present. Removed %d chunks.", name, removedChunks)
+			summary.Removed = append(summary.Removed, name)
+		}
+		sort.Strings(summary.Removed)
+	}
+
+	if err := a.store.Save(); err != nil {
+		errMsg := fmt.Sprintf("loaded %d chunks but could not persist them: %v", summary.ChunksLoaded, err)
+		log.Println(errMsg)
+		progress.event.Error = errMsg
+		progress.event.Summary = &summary
+		progress.emit("error")
+		return
+	}
+
+	summary.Message = fmt.Sprintf("Indexed %s: %d added, %d updated, %d removed, %d unchanged, %d failed, %d skipped (%d new chunks).",
+		directoryPath, len(summary.Added), len(summary.Updated), len(summary.Removed), len(summary.Unchanged), len(summary.Failed), len(summary.Skipped), summary.ChunksLoaded)
+	status := "done"
+	if cancelled {
+		summary.Message = fmt.Sprintf("Load cancelled after %d of %d files. %s", progress.event.FilesDone, progress.event.FilesTotal, summary.Message)
+		status = "cancelled"
+	}
+	log.Println(summary.Message)
+	progress.event.Message = summary.Message
+	progress.event.Summary = &summary
+	progress.emit(status)
+	a.emitIndexStatus()
+}
+
+// prepareFile works out whether a source file needs to be re-indexed. Files whose size
+// and modification time match the stored record are skipped without being read;
+// otherwise the content hash decides. It returns nil for unchanged files, and for
+// changed ones a pendingFile holding the extracted chunks, still without embeddings.
+// The metadata of unchanged files is derived again with the current options.
+func (a *App) prepareFile(file documentFile, options LoadOptions) (*pendingFile, error) {
+	filePath, info := file.Path, file.Info
+	record, known := a.store.FileRecord(file.RelPath)
+	if known && record.Size == info.Size() && record.ModTime.Equal(info.ModTime()) {
+		log.Printf("File %s unchanged since last load (size and modification time match). Skipping.", filePath)
+		a.store.RefreshFileMetadata(file.RelPath, options)
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read file %s: %w", filePath, err)
+	}
+
+	newRecord := FileRecord{
+		SourceFile:  file.RelPath,
+		ContentHash: hashContent(content),
+		ModTime:     info.ModTime(),
+		Size:        info.Size(),
+	}
+	if known && record.ContentHash == newRecord.ContentHash {
+		log.Printf("File %s was touched but its content hash is unchanged. Skipping.", filePath)
+		newRecord.Metadata, newRecord.Header = record.Metadata, record.Header // Same content, so the same title and date would be found
+		a.store.SetFileRecord(newRecord)
+		a.store.RefreshFileMetadata(file.RelPath, options)
+		return nil, nil
+	}
+
+	doc, err := extractDocument(filePath, content)
+	if err != nil {
+		return nil, fmt.Errorf("could not extract text from %s: %w", filePath, err)
+	}
+	newRecord.Metadata = doc.Metadata
+	newRecord.Header = headerMetadataOf(documentHeader(doc))
+	metadata := chunkMetadataFor(file.RelPath, doc.Metadata, newRecord.Header, options)
+	log.Printf("File %s: document type %q, date %q, patient %q, tags %v.", filePath, metadata.DocType, metadata.Date, metadata.PatientID, metadata.Tags)
+
+	var chunks []DocumentChunk
+	for _, page := range doc.Pages {
+		textChunks := chunkTextRecursive(page.Text, defaultChunkSizeChars, defaultOverlapChars)
+		if page.Page > 0 {
+			log.Printf("File %s page %d split into %d chunks using recursive strategy.", filePath, page.Page, len(textChunks))
+		} else {
+			log.Printf("File %s split into %d chunks using recursive strategy.", filePath, len(textChunks))
+		}
+
+		for _, chunkText := range textChunks {
+			if strings.TrimSpace(chunkText) == "" {
+				log.Printf("Skipping empty or whitespace-only chunk from file %s", filePath)
+				continue // Skip empty chunks
+			}
+			chunks = append(chunks, DocumentChunk{Text: chunkText, Page: page.Page, Metadata: metadata})
+		}
+	}
+
+	return &pendingFile{file: file, record: newRecord, chunks: chunks}, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func init() {
+	registerExtractor(fixtureExtractor{})
+}
+
+// fixtureExtractor reads ".fixture" test files, one page per line, reporting the
+// document metadata an Office or PDF extractor would.
+type fixtureExtractor struct{}
+
+func (fixtureExtractor) Name() string         { return "fixture" }
+func (fixtureExtractor) Extensions() []string { return []string{".fixture"} }
+func (fixtureExtractor) MIMETypes() []string  { return nil }
+
+func (fixtureExtractor) Extract(content []byte) (ExtractedDocument, error) {
+	var doc ExtractedDocument
+	for i, line := range splitLines(string(content)) {
+		doc.Pages = append(doc.Pages, pageText{Page: i + 1, Text: line})
+	}
+	doc.Metadata = DocumentMetadata{Title: "Echocardiogram", Date: "2023-02-05T10:00:00Z", PageCount: len(doc.Pages)}
+	return doc, nil
+}
+
+// splitLines splits text at newlines, dropping empty lines.
+func splitLines(text string) []string {
+	var lines []string
+	start := 0
+	for i := 0; i <= len(text); i++ {
+		if i == len(text) || text[i] == '\n' {
+			if i > start {
+				lines = append(lines, text[start:i])
+			}
+			start = i + 1
+		}
+	}
+	return lines
+}
+
+// loadTestFile runs a file through prepareFile as LoadPersonalData does, storing the
+// chunks of a new or changed file. It reports whether the file was re-indexed.
+func loadTestFile(t *testing.T, a *App, root, relPath string) bool {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(relPath))
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := a.prepareFile(documentFile{Path: path, RelPath: relPath, Info: info}, defaultLoadOptions())
+	if err != nil {
+		t.Fatalf("prepareFile() error = %v", err)
+	}
+	if p == nil {
+		return false
+	}
+	a.store.ReplaceFile(p.record, p.chunks)
+	return true
+}
+
+func TestTouchedFileKeepsMetadata(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "report.fixture")
+	if err := os.WriteFile(path, []byte("Findings: normal left ventricle.\nConclusion: no change."), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	a := NewApp()
+	if !loadTestFile(t, a, root, "report.fixture") {
+		t.Fatal("new file was not indexed")
+	}
+	before := a.store.chunks[0].Metadata
+	if before.Date != "2023-02-05" || before.DocType != "cardiology" {
+		t.Fatalf("metadata after the first load = %+v, want the extractor's date and title", before)
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if loadTestFile(t, a, root, "report.fixture") {
+		t.Fatal("touched file with the same content was re-indexed")
+	}
+	record, _ := a.store.FileRecord("report.fixture")
+	if record.Metadata.Title != "Echocardiogram" || !record.ModTime.Equal(later) {
+		t.Errorf("record after touching = %+v, want the new time and the extractor's metadata", record)
+	}
+	for _, chunk := range a.store.chunks {
+		if chunk.Metadata.Date != before.Date || chunk.Metadata.DocType != before.DocType {
+			t.Errorf("chunk %d metadata after touching = %+v, want %+v", chunk.ID, chunk.Metadata, before)
+		}
+	}
+}
+
+func TestRefreshMatchesFreshLoad(t *testing.T) {
+	// The date is on the second page, so it is in the header but not in the first chunk.
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "report.fixture"), []byte("Patient ID: 1234. Echocardiogram.\nSeen on 01/03/2024."), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	a := NewApp()
+	loadTestFile(t, a, root, "report.fixture")
+	if len(a.store.chunks) < 2 {
+		t.Fatalf("stored %d chunks, want one per page", len(a.store.chunks))
+	}
+	fresh := a.store.chunks[0].Metadata
+	if fresh.Date != "2024-03-01" || fresh.PatientID != "1234" {
+		t.Fatalf("metadata after loading = %+v, want the patient and date of the header", fresh)
+	}
+
+	// Loading again with a tag rule only refreshes the metadata of the unchanged file
+	options := defaultLoadOptions()
+	options.TagRules = []TagRule{{Pattern: "*.fixture", Tags: []string{"echo"}}}
+	path := filepath.Join(root, "report.fixture")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := a.prepareFile(documentFile{Path: path, RelPath: "report.fixture", Info: info}, options); p != nil || err != nil {
+		t.Fatalf("prepareFile() of an unchanged file = %v, %v; want nothing to index", p, err)
+	}
+	for _, chunk := range a.store.chunks {
+		meta := chunk.Metadata
+		if meta.Date != fresh.Date || meta.PatientID != fresh.PatientID || len(meta.Tags) != 1 {
+			t.Errorf("chunk %d metadata after refreshing = %+v, want %+v tagged echo", chunk.ID, meta, fresh)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const metadataHeaderRunes = 1000 // Start of a document searched for its patient ID and date
+
+// ChunkMetadata describes the document a chunk comes from, so retrieval can be
+// restricted to one patient, document type or period.
+type ChunkMetadata struct {
+	Path      string   `json:"path"`                 // Source path relative to the loaded folder
+	DocType   string   `json:"doc_type,omitempty"`   // Document type, one of docTypeKeywords
+	Date      string   `json:"date,omitempty"`       // Document date as YYYY-MM-DD
+	PatientID string   `json:"patient_id,omitempty"` // Patient identifier from the path or the document header
+	Tags      []string `json:"tags,omitempty"`       // Custom tags from LoadOptions.TagRules
+}
+
+// TagRule tags the files matching a glob pattern, using the same pattern syntax as
+// the include and exclude patterns of LoadOptions.
+type TagRule struct {
+	Pattern string   `json:"pattern"`
+	Tags    []string `json:"tags"`
+}
+
+// docTypeKeywords maps each document type to the words identifying it in a path or
+// title, in English and French. The first type with a matching word wins.
+var docTypeKeywords = []struct {
+	docType  string
+	keywords []string
+}{
+	{"cardiology", []string{"cardio", "cardiology", "cardiologie", "echo", "echocardiogram", "echocardiography", "echocardiographie", "ecg", "ekg", "holter"}},
+	{"lab", []string{"lab", "labs", "laboratory", "laboratoire", "blood", "biology", "biologie", "bilan"}},
+	{"radiology", []string{"radiology", "radiologie", "radio", "xray", "x-ray", "ct", "mri", "irm", "scanner", "ultrasound", "echographie"}},
+	{"prescription", []string{"prescription", "prescriptions", "ordonnance", "ordonnances"}},
+	{"letter", []string{"letter", "letters", "discharge", "referral", "courrier", "courriers", "lettre"}},
+}
+
+var (
+	// patientPathPattern matches a folder or file name such as "patient_1234" or "IPP-1234".
+	patientPathPattern = regexp.MustCompile(`(?i)(?:^|[^a-z])(?:patient|pat|ipp|mrn)[ _-]?(?:id[ _-]?)?([0-9][a-z0-9]*)`)
+	// patientHeaderPattern matches a line such as "Patient ID: 1234" or "IPP : 1234".
+	patientHeaderPattern = regexp.MustCompile(`(?i)\b(?:patient\s*(?:id|no\.?|number|#)|ipp|mrn)\s*[:#]?\s*([a-z0-9][a-z0-9-]*[0-9][a-z0-9-]*)`)
+	// isoDatePattern matches "2024-03-01", "2024_03_01" and "20240301".
+	isoDatePattern = regexp.MustCompile(`(?:^|[^0-9])((?:19|20)[0-9]{2})[-_.]?(0[1-9]|1[0-2])[-_.]?(0[1-9]|[12][0-9]|3[01])(?:[^0-9]|$)`)
+	// dayFirstDatePattern matches "01/03/2024" and "1.3.2024", read day first as in
+	// European documents.
+	dayFirstDatePattern = regexp.MustCompile(`(?:^|[^0-9])(0?[1-9]|[12][0-9]|3[01])[/.](0?[1-9]|1[0-2])[/.]((?:19|20)[0-9]{2})(?:[^0-9]|$)`)
+	// filterDatePattern matches the bounds accepted by the after and before filters.
+	filterDatePattern = regexp.MustCompile(`^[0-9]{4}(-[0-9]{2}(-[0-9]{2})?)?$`)
+)
+
+// HeaderMetadata is what the start of a document's text says about it. It is kept in
+// the file record, so the chunk metadata of an unchanged file can be derived again
+// without extracting its text.
+type HeaderMetadata struct {
+	PatientID string `json:"patient_id,omitempty"` // Patient identifier from a line such as "Patient ID: 1234"
+	Date      string `json:"date,omitempty"`       // First date in the header as YYYY-MM-DD
+}
+
+// headerMetadataOf returns the patient ID and date found in the start of a document's text.
+func headerMetadataOf(header string) HeaderMetadata {
+	var meta HeaderMetadata
+	if match := patientHeaderPattern.FindStringSubmatch(header); match != nil {
+		meta.PatientID = match[1]
+	}
+	meta.Date = findDate(header)
+	return meta
+}
+
+// documentHeader returns the start of a document's text, where the patient and date
+// are usually written.
+func documentHeader(doc ExtractedDocument) string {
+	var header strings.Builder
+	for _, page := range doc.Pages {
+		if header.Len() >= metadataHeaderRunes {
+			break
+		}
+		header.WriteString(page.Text)
+		header.WriteString("\n")
+	}
+	if runes := []rune(header.String()); len(runes) > metadataHeaderRunes {
+		return string(runes[:metadataHeaderRunes])
+	}
+	return header.String()
+}
+
+// chunkMetadataFor works out the metadata of a document from its relative path, the
+// metadata reported by the extractor and found in the start of its text, with the
+// tag rules and patient folder of options. The path is trusted over the text, since
+// folders are usually organised on purpose.
+func chunkMetadataFor(relPath string, doc DocumentMetadata, header HeaderMetadata, options LoadOptions) ChunkMetadata {
+	meta := ChunkMetadata{Path: relPath, Tags: tagsFor(options.TagRules, relPath)}
+	meta.DocType = docTypeOf(relPath + " " + doc.Title)
+	meta.PatientID = patientFromPath(relPath, options.PatientPathSegment)
+	if meta.PatientID == "" {
+		meta.PatientID = header.PatientID
+	}
+
+	meta.Date = findDate(relPath)
+	if meta.Date == "" {
+		meta.Date = header.Date
+	}
+	if meta.Date == "" && len(doc.Date) >= 10 {
+		// The extractor's date is often when the file was exported, so it comes last.
+		if _, err := time.Parse("2006-01-02", doc.Date[:10]); err == nil {
+			meta.Date = doc.Date[:10]
+		}
+	}
+	return meta
+}
+
+// patientFromPath returns the patient ID in a relative path: the folder at level
+// segment (1 for the top folder) if set, as in the "<patient>/<year>/<visit>/" layout,
+// otherwise a folder or file name such as "patient_1234". It returns "" if there is none.
+func patientFromPath(relPath string, segment int) string {
+	if folders := strings.Split(relPath, "/"); segment > 0 && segment < len(folders) {
+		return folders[segment-1]
+	}
+	if match := patientPathPattern.FindStringSubmatch(relPath); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// docTypeOf returns the document type whose keywords occur in text, or "".
+func docTypeOf(text string) string {
+	terms := keywordTerms(text)
+	for _, entry := range docTypeKeywords {
+		for _, term := range terms {
+			if slices.Contains(entry.keywords, term) {
+				return entry.docType
+			}
+		}
+	}
+	return ""
+}
+
+// findDate returns the first valid date in text as YYYY-MM-DD, or "".
+func findDate(text string) string {
+	type candidate struct {
+		at               int
+		year, month, day string
+	}
+	var candidates []candidate
+	for _, m := range isoDatePattern.FindAllStringSubmatchIndex(text, -1) {
+		candidates = append(candidates, candidate{m[0], text[m[2]:m[3]], text[m[4]:m[5]], text[m[6]:m[7]]})
+	}
+	for _, m := range dayFirstDatePattern.FindAllStringSubmatchIndex(text, -1) {
+		candidates = append(candidates, candidate{m[0], text[m[6]:m[7]], text[m[4]:m[5]], text[m[2]:m[3]]})
+	}
+	slices.SortStableFunc(candidates, func(a, b candidate) int { return a.at - b.at })
+	for _, c := range candidates {
+		// Invalid dates such as 31 February are skipped
+		if date, err := time.Parse("2006-1-2", c.year+"-"+c.month+"-"+c.day); err == nil {
+			return date.Format("2006-01-02")
+		}
+	}
+	return ""
+}
+
+// tagsFor returns the tags of every rule matching relPath, lower-cased and without
+// duplicates.
+func tagsFor(rules []TagRule, relPath string) []string {
+	var tags []string
+	for _, rule := range rules {
+		if !matchAny([]string{rule.Pattern}, relPath) {
+			continue
+		}
+		for _, tag := range rule.Tags {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			if tag != "" && !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// chunkFilter restricts retrieval to chunks whose metadata matches every field that is
+// set. A field with several values matches any of them.
+type chunkFilter struct {
+	patients []string
+	docTypes []string
+	tags     []string
+	paths    []string // Glob patterns, as in LoadOptions
+	after    string   // Earliest date, inclusive; YYYY, YYYY-MM or YYYY-MM-DD
+	before   string   // Latest date, inclusive, at the same precisions
+}
+
+// parseChunkFilter parses a filter expression: space-separated key:value terms that
+// must all match, where a value may list alternatives separated by commas and be
+// quoted to contain spaces. Keys are patient, type, tag, path, after and before, e.g.
+//
+//	patient:1234 type:cardiology,radiology after:2023 tag:"follow up"
+func parseChunkFilter(expression string) (chunkFilter, error) {
+	var filter chunkFilter
+	terms, err := splitFilterTerms(expression)
+	if err != nil {
+		return filter, err
+	}
+	for _, term := range terms {
+		key, value, ok := strings.Cut(term, ":")
+		if !ok || value == "" {
+			return filter, fmt.Errorf("filter term %q must be key:value", term)
+		}
+		var values []string
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		switch strings.ToLower(key) {
+		case "patient":
+			filter.patients = append(filter.patients, values...)
+		case "type":
+			for _, v := range values {
+				v = strings.ToLower(v)
+				if !slices.Contains(docTypes(), v) {
+					return filter, fmt.Errorf("unknown document type %q; known types are %s", v, strings.Join(docTypes(), ", "))
+				}
+				filter.docTypes = append(filter.docTypes, v)
+			}
+		case "tag":
+			for _, v := range values {
+				filter.tags = append(filter.tags, strings.ToLower(v))
+			}
+		case "path":
+			filter.paths = append(filter.paths, values...)
+		case "after", "before":
+			if len(values) != 1 || !filterDatePattern.MatchString(values[0]) {
+				return filter, fmt.Errorf("%s date %q must be YYYY, YYYY-MM or YYYY-MM-DD", key, value)
+			}
+			if strings.ToLower(key) == "after" {
+				filter.after = values[0]
+			} else {
+				filter.before = values[0]
+			}
+		default:
+			return filter, fmt.Errorf("unknown filter key %q; use patient, type, tag, path, after or before", key)
+		}
+	}
+	return filter, nil
+}
+
+// splitFilterTerms splits a filter expression at spaces outside double quotes and
+// removes the quotes.
+func splitFilterTerms(expression string) ([]string, error) {
+	var terms []string
+	var term strings.Builder
+	quoted := false
+	for _, r := range expression {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case !quoted && (r == ' ' || r == '\t' || r == '\n' || r == '\r'):
+			if term.Len() > 0 {
+				terms = append(terms, term.String())
+				term.Reset()
+			}
+		default:
+			term.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in filter %q", expression)
+	}
+	if term.Len() > 0 {
+		terms = append(terms, term.String())
+	}
+	return terms, nil
+}
+
+// docTypes returns the known document types.
+func docTypes() []string {
+	types := make([]string, len(docTypeKeywords))
+	for i, entry := range docTypeKeywords {
+		types[i] = entry.docType
+	}
+	return types
+}
+
+// empty reports whether the filter lets every chunk through.
+func (f chunkFilter) empty() bool {
+	return len(f.patients) == 0 && len(f.docTypes) == 0 && len(f.tags) == 0 && len(f.paths) == 0 && f.after == "" && f.before == ""
+}
+
+// matches reports whether a chunk with the given metadata passes the filter. Chunks
+// without a date never pass a date bound.
+func (f chunkFilter) matches(meta ChunkMetadata) bool {
+	if len(f.patients) > 0 && !slices.ContainsFunc(f.patients, func(p string) bool { return strings.EqualFold(p, meta.PatientID) }) {
+		return false
+	}
+	if len(f.docTypes) > 0 && !slices.Contains(f.docTypes, meta.DocType) {
+		return false
+	}
+	if len(f.tags) > 0 && !slices.ContainsFunc(f.tags, func(t string) bool { return slices.Contains(meta.Tags, t) }) {
+		return false
+	}
+	if len(f.paths) > 0 && !matchAny(f.paths, meta.Path) {
+		return false
+	}
+	if f.after != "" && (meta.Date == "" || meta.Date[:min(len(f.after), len(meta.Date))] < f.after) {
+		return false
+	}
+	if f.before != "" && (meta.Date == "" || meta.Date[:min(len(f.before), len(meta.Date))] > f.before) {
+		return false
+	}
+	return true
+}
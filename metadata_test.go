@@ -0,0 +1,121 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseChunkFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		want       chunkFilter
+		wantErr    bool
+	}{
+		{"empty", "  ", chunkFilter{}, false},
+		{"patient", "patient:1234", chunkFilter{patients: []string{"1234"}}, false},
+		{"alternatives", "type:Cardiology,lab", chunkFilter{docTypes: []string{"cardiology", "lab"}}, false},
+		{"empty alternatives dropped", "patient:1234,,5678,", chunkFilter{patients: []string{"1234", "5678"}}, false},
+		{"repeated key", "patient:1234 patient:5678", chunkFilter{patients: []string{"1234", "5678"}}, false},
+		{"quoted value", `tag:"Follow Up"`, chunkFilter{tags: []string{"follow up"}}, false},
+		{"quoted alternatives", `tag:"follow up,second opinion"`, chunkFilter{tags: []string{"follow up", "second opinion"}}, false},
+		{"quoted path", `path:"scans 2023/**"`, chunkFilter{paths: []string{"scans 2023/**"}}, false},
+		{"upper-case key", "PATIENT:1234", chunkFilter{patients: []string{"1234"}}, false},
+		{"every key", "patient:1 type:lab tag:x path:a/** after:2023 before:2024-06",
+			chunkFilter{patients: []string{"1"}, docTypes: []string{"lab"}, tags: []string{"x"}, paths: []string{"a/**"}, after: "2023", before: "2024-06"}, false},
+		{"date precisions", "after:2023-01-15 before:2024", chunkFilter{after: "2023-01-15", before: "2024"}, false},
+		{"unterminated quote", `tag:"follow up`, chunkFilter{}, true},
+		{"missing value", "patient:", chunkFilter{}, true},
+		{"not key:value", "cardiology", chunkFilter{}, true},
+		{"unknown key", "doctor:house", chunkFilter{}, true},
+		{"unknown type", "type:dermatology", chunkFilter{}, true},
+		{"day-first date", "after:01/02/2023", chunkFilter{}, true},
+		{"several dates", "after:2023,2024", chunkFilter{}, true},
+		{"short year", "before:23", chunkFilter{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseChunkFilter(tt.expression)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseChunkFilter(%q) error = %v, wantErr %t", tt.expression, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseChunkFilter(%q) = %+v, want %+v", tt.expression, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChunkFilterMatches(t *testing.T) {
+	meta := ChunkMetadata{Path: "1234/2023/echo.txt", DocType: "cardiology", Date: "2023-02-05", PatientID: "P1234", Tags: []string{"follow up"}}
+	tests := []struct {
+		name   string
+		filter chunkFilter
+		meta   ChunkMetadata
+		want   bool
+	}{
+		{"empty filter", chunkFilter{}, ChunkMetadata{}, true},
+		{"patient, any case", chunkFilter{patients: []string{"p1234"}}, meta, true},
+		{"other patient", chunkFilter{patients: []string{"5678"}}, meta, false},
+		{"one of the types", chunkFilter{docTypes: []string{"lab", "cardiology"}}, meta, true},
+		{"other type", chunkFilter{docTypes: []string{"lab"}}, meta, false},
+		{"tag", chunkFilter{tags: []string{"follow up"}}, meta, true},
+		{"missing tag", chunkFilter{tags: []string{"urgent"}}, meta, false},
+		{"path", chunkFilter{paths: []string{"1234/**"}}, meta, true},
+		{"other path", chunkFilter{paths: []string{"5678/**"}}, meta, false},
+		{"every field", chunkFilter{patients: []string{"P1234"}, docTypes: []string{"cardiology"}, after: "2023", before: "2023"}, meta, true},
+		{"one field fails", chunkFilter{patients: []string{"P1234"}, docTypes: []string{"lab"}}, meta, false},
+
+		{"after same year", chunkFilter{after: "2023"}, meta, true},
+		{"after next year", chunkFilter{after: "2024"}, meta, false},
+		{"after same month", chunkFilter{after: "2023-02"}, meta, true},
+		{"after next month", chunkFilter{after: "2023-03"}, meta, false},
+		{"after same day", chunkFilter{after: "2023-02-05"}, meta, true},
+		{"after next day", chunkFilter{after: "2023-02-06"}, meta, false},
+		{"before same year", chunkFilter{before: "2023"}, meta, true},
+		{"before previous year", chunkFilter{before: "2022"}, meta, false},
+		{"before same month", chunkFilter{before: "2023-02"}, meta, true},
+		{"before previous month", chunkFilter{before: "2023-01"}, meta, false},
+		{"before same day", chunkFilter{before: "2023-02-05"}, meta, true},
+		{"before previous day", chunkFilter{before: "2023-02-04"}, meta, false},
+		{"undated chunk", chunkFilter{after: "2000"}, ChunkMetadata{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.matches(tt.meta); got != tt.want {
+				t.Errorf("%+v.matches(%+v) = %t, want %t", tt.filter, tt.meta, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindDate(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"ISO", "Report of 2024-03-01.", "2024-03-01"},
+		{"ISO with underscores", "scan_2024_03_01.pdf", "2024-03-01"},
+		{"ISO compact", "echo-20240301.txt", "2024-03-01"},
+		{"day first", "Seen on 05/02/2023 for chest pain.", "2023-02-05"},
+		{"day first with dots", "Consultation du 1.3.2024", "2024-03-01"},
+		{"day first, day over 12", "Date: 25/12/2022", "2022-12-25"},
+		{"first of several", "Follow-up on 10/01/2024 after the 2023-11-02 visit.", "2024-01-10"},
+		{"invalid date skipped", "Dated 31/02/2023, corrected to 28/02/2023.", "2023-02-28"},
+		{"invalid ISO date skipped", "2023-02-30 then 2023-03-01", "2023-03-01"},
+		{"leap day", "29/02/2024", "2024-02-29"},
+		{"not a leap year", "29/02/2023", ""},
+		{"longer number", "Order 1202403015", ""},
+		{"phone number", "Call 01 23 45 67 89", ""},
+		{"year out of range", "1850-01-01", ""},
+		{"none", "Blood pressure 130/85.", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findDate(tt.text); got != tt.want {
+				t.Errorf("findDate(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log"
+	"math"
+)
+
+const (
+	defaultMMRLambda   = 1 // Relevance only: diversification is opt-in, as it costs retrieving more candidates
+	mmrCandidateFactor = 4 // Diversified retrieval picks the top N from this many times N candidates
+)
+
+// diversify reports whether selectChunks does more than keep the first top N.
+func (o RetrievalOptions) diversify() bool {
+	return o.MMRLambda < 1 || o.MaxChunksPerFile > 0
+}
+
+// relevance returns the score chunks are selected by: the re-rank score if there is
+// one, the retrieval score otherwise.
+func (c DocumentChunk) relevance() float64 {
+	if c.Reranked {
+		return c.RerankScore
+	}
+	return c.Score
+}
+
+// selectChunks picks the top N of candidates ordered best first, using Maximal Marginal
+// Relevance (Carbonell & Goldstein, 1998): each pick maximises
+// lambda * relevance - (1 - lambda) * the highest similarity to a chunk already picked,
+// so overlapping chunks of one paragraph don't fill every place. Relevance is rescaled
+// to 0..1 over the candidates first, since cosine, fused and re-rank scores each have
+// their own range and would otherwise weigh differently against cosine redundancy.
+// Chunks from a file that already supplied MaxChunksPerFile chunks are skipped.
+func (o RetrievalOptions) selectChunks(candidates []DocumentChunk) []DocumentChunk {
+	if !o.diversify() {
+		return candidates[:min(o.TopN, len(candidates))]
+	}
+
+	relevance := normalizedRelevance(candidates)
+	selected := make([]DocumentChunk, 0, o.TopN)
+	perFile := make(map[string]int)
+	redundancy := make([]float64, len(candidates)) // Highest similarity to a selected chunk
+	picked := make([]bool, len(candidates))
+	for len(selected) < o.TopN {
+		best, bestScore := -1, 0.0
+		for i, candidate := range candidates {
+			if picked[i] || (o.MaxChunksPerFile > 0 && perFile[candidate.SourceFile] >= o.MaxChunksPerFile) {
+				continue
+			}
+			score := o.MMRLambda*relevance[i] - (1-o.MMRLambda)*redundancy[i]
+			if best < 0 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			break // Every remaining candidate comes from a file that reached its cap
+		}
+
+		chosen := candidates[best]
+		picked[best] = true
+		perFile[chosen.SourceFile]++
+		selected = append(selected, chosen)
+		for i, candidate := range candidates {
+			if picked[i] {
+				continue
+			}
+			if similarity, err := cosineSimilarity(chosen.Embedding, candidate.Embedding); err == nil && (len(selected) == 1 || similarity > redundancy[i]) {
+				redundancy[i] = similarity
+			}
+		}
+	}
+	if len(selected) > 0 && len(selected) < len(candidates) {
+		log.Printf("Selected %d of %d candidates from %d files (MMR lambda %.2f, max %d chunks per file).",
+			len(selected), len(candidates), len(perFile), o.MMRLambda, o.MaxChunksPerFile)
+	}
+	return selected
+}
+
+// normalizedRelevance returns the relevance of each candidate rescaled so the least
+// relevant scores 0 and the most relevant 1. Equal relevances all score 1.
+func normalizedRelevance(candidates []DocumentChunk) []float64 {
+	relevance := make([]float64, len(candidates))
+	if len(candidates) == 0 {
+		return relevance
+	}
+	lowest, highest := candidates[0].relevance(), candidates[0].relevance()
+	for _, candidate := range candidates {
+		lowest = math.Min(lowest, candidate.relevance())
+		highest = math.Max(highest, candidate.relevance())
+	}
+	for i, candidate := range candidates {
+		if highest > lowest {
+			relevance[i] = (candidate.relevance() - lowest) / (highest - lowest)
+		} else {
+			relevance[i] = 1
+		}
+	}
+	return relevance
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSelectChunks(t *testing.T) {
+	// Chunks 1 and 2 overlap almost entirely, chunk 3 a little and chunk 4 not at all.
+	withScores := func(scores ...float64) []DocumentChunk {
+		chunks := []DocumentChunk{
+			{ID: 1, SourceFile: "a.txt", Embedding: []float32{1, 0}},
+			{ID: 2, SourceFile: "a.txt", Embedding: []float32{0.995, 0.0998}},
+			{ID: 3, SourceFile: "b.txt", Embedding: []float32{0.3, 0.954}},
+			{ID: 4, SourceFile: "c.txt", Embedding: []float32{0, 1}},
+		}
+		for i := range chunks {
+			chunks[i].Score = scores[i]
+		}
+		return chunks
+	}
+	reranked := withScores(0.5, 0.6, 0.7, 0.9)
+	for i, score := range []float64{1, 0.9, 0.8, 0.2} {
+		reranked[i].Reranked, reranked[i].RerankScore = true, score
+	}
+	tests := []struct {
+		name       string
+		lambda     float64
+		perFile    int
+		candidates []DocumentChunk
+		want       []int
+	}{
+		{"default keeps the ranking", defaultMMRLambda, 0, withScores(0.9, 0.88, 0.85, 0.5), []int{1, 2}},
+		{"cosine scores", 0.5, 0, withScores(0.9, 0.88, 0.85, 0.5), []int{1, 3}},
+		// RRF scores differ by thousandths, so without rescaling redundancy alone would
+		// decide and pick the weakest chunk 4.
+		{"fused scores", 0.5, 0, withScores(0.0164, 0.0162, 0.0160, 0.0100), []int{1, 3}},
+		{"re-rank scores", 0.5, 0, reranked, []int{1, 3}},
+		{"per-file cap", 1, 1, withScores(0.9, 0.88, 0.85, 0.5), []int{1, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := RetrievalOptions{TopN: 2, MMRLambda: tt.lambda, MaxChunksPerFile: tt.perFile}
+			selected := options.selectChunks(tt.candidates)
+			if len(selected) != len(tt.want) {
+				t.Fatalf("selected %d chunks, want %v", len(selected), tt.want)
+			}
+			for i, chunk := range selected {
+				if chunk.ID != tt.want[i] {
+					t.Fatalf("selected chunk %d at %d, want %v", chunk.ID, i, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizedRelevance(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []DocumentChunk
+		want       []float64
+	}{
+		{"none", nil, []float64{}},
+		{"range", []DocumentChunk{{Score: 0.8}, {Score: 0.5}, {Score: 0.6}}, []float64{1, 0, 1.0 / 3}},
+		{"equal", []DocumentChunk{{Score: 0.4}, {Score: 0.4}}, []float64{1, 1}},
+		{"re-rank score", []DocumentChunk{{Score: 0.9, Reranked: true, RerankScore: 0.2}, {Score: 0.1, Reranked: true, RerankScore: 0.6}}, []float64{0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := normalizedRelevance(tt.candidates)
+			if len(got) != len(tt.want) {
+				t.Fatalf("normalizedRelevance() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if math.Abs(got[i]-tt.want[i]) > 1e-9 {
+					t.Fatalf("normalizedRelevance() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
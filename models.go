@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const modelCheckTimeout = 5 * time.Second // Time allowed for /api/tags when checking the configured models
+
+// ModelInfo describes an installed model, as listed by /api/tags.
+type ModelInfo struct {
+	Name              string `json:"name"` // Full name including the tag, e.g. "llama3:latest"
+	Size              int64  `json:"size"` // Bytes on disk
+	Digest            string `json:"digest"`
+	ModifiedAt        string `json:"modifiedAt"`
+	Family            string `json:"family,omitempty"`
+	ParameterSize     string `json:"parameterSize,omitempty"` // e.g. "8.0B"
+	QuantizationLevel string `json:"quantizationLevel,omitempty"`
+}
+
+// ModelDetails describes one model in depth, as returned by /api/show.
+type ModelDetails struct {
+	Name              string `json:"name"`
+	Family            string `json:"family,omitempty"`
+	Format            string `json:"format,omitempty"`
+	ParameterSize     string `json:"parameterSize,omitempty"`
+	QuantizationLevel string `json:"quantizationLevel,omitempty"`
+	ContextLength     int    `json:"contextLength,omitempty"`   // Maximum context window in tokens, if reported
+	EmbeddingLength   int    `json:"embeddingLength,omitempty"` // Size of the model's embedding vectors, if reported
+	Parameters        string `json:"parameters,omitempty"`      // Default generation parameters from the Modelfile
+	Template          string `json:"template,omitempty"`        // Prompt template from the Modelfile
+}
+
+// ModelCheck reports whether the configured models are installed on the Ollama server.
+type ModelCheck struct {
+	Reachable               bool     `json:"reachable"`
+	ChatModel               string   `json:"chatModel"`
+	ChatModelInstalled      bool     `json:"chatModelInstalled"`
+	EmbeddingModel          string   `json:"embeddingModel"`
+	EmbeddingModelInstalled bool     `json:"embeddingModelInstalled"`
+	Missing                 []string `json:"missing"`           // Configured models that need to be pulled
+	Message                 string   `json:"message,omitempty"` // What the user should do; empty when everything is in place
+}
+
+// ModelPullEvent is the payload of modelPullEvent, sent while PullModel downloads a model.
+type ModelPullEvent struct {
+	Model     string  `json:"model"`
+	Status    string  `json:"status"` // Status line from Ollama, e.g. "pulling manifest" or "success"
+	Digest    string  `json:"digest,omitempty"`
+	Total     int64   `json:"total,omitempty"`     // Bytes of the layer being downloaded
+	Completed int64   `json:"completed,omitempty"` // Bytes of the layer downloaded so far
+	Percent   float64 `json:"percent,omitempty"`
+	Done      bool    `json:"done"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ollamaTagsResponse is the response of /api/tags.
+type ollamaTagsResponse struct {
+	Models []struct {
+		Name       string             `json:"name"`
+		Size       int64              `json:"size"`
+		Digest     string             `json:"digest"`
+		ModifiedAt string             `json:"modified_at"`
+		Details    ollamaModelDetails `json:"details"`
+	} `json:"models"`
+}
+
+// ollamaModelDetails is the details object of /api/tags and /api/show.
+type ollamaModelDetails struct {
+	Format            string `json:"format"`
+	Family            string `json:"family"`
+	ParameterSize     string `json:"parameter_size"`
+	QuantizationLevel string `json:"quantization_level"`
+}
+
+// ollamaShowResponse is the response of /api/show.
+type ollamaShowResponse struct {
+	Parameters string                 `json:"parameters"`
+	Template   string                 `json:"template"`
+	Details    ollamaModelDetails     `json:"details"`
+	ModelInfo  map[string]interface{} `json:"model_info"` // Keys are prefixed with the architecture, e.g. "llama.context_length"
+}
+
+// ollamaPullProgress is one line of the streamed /api/pull response.
+type ollamaPullProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest"`
+	Total     int64  `json:"total"`
+	Completed int64  `json:"completed"`
+	Error     string `json:"error"`
+}
+
+// modelNameMatches reports whether an installed model name satisfies a configured one.
+// A configured name without a tag means the "latest" tag, as in the Ollama CLI.
+func modelNameMatches(configured, installed string) bool {
+	withTag := func(name string) string {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !strings.Contains(name, ":") {
+			name += ":latest"
+		}
+		return name
+	}
+	return withTag(configured) == withTag(installed)
+}
+
+// ollamaJSON sends a request to an Ollama API endpoint and decodes the JSON response
+// into out. A nil body sends a GET request.
+func (a *App) ollamaJSON(ctx context.Context, endpoint string, body interface{}, out interface{}) error {
+	method := http.MethodGet
+	var reader io.Reader
+	if body != nil {
+		jsonBody, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("could not process %s request (marshal): %w", endpoint, err)
+		}
+		method = http.MethodPost
+		reader = bytes.NewReader(jsonBody)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.ollamaURL(endpoint), reader)
+	if err != nil {
+		return fmt.Errorf("could not create %s request: %w", endpoint, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not connect to Ollama service: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("ollama %s API error (%s): %s", endpoint, resp.Status, strings.TrimSpace(string(bodyBytes)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("could not parse Ollama %s response: %w", endpoint, err)
+	}
+	return nil
+}
+
+// listModels returns the models installed on the Ollama server.
+func (a *App) listModels(ctx context.Context) ([]ModelInfo, error) {
+	var tags ollamaTagsResponse
+	if err := a.ollamaJSON(ctx, "tags", nil, &tags); err != nil {
+		return nil, err
+	}
+	models := make([]ModelInfo, 0, len(tags.Models))
+	for _, m := range tags.Models {
+		models = append(models, ModelInfo{
+			Name:              m.Name,
+			Size:              m.Size,
+			Digest:            m.Digest,
+			ModifiedAt:        m.ModifiedAt,
+			Family:            m.Details.Family,
+			ParameterSize:     m.Details.ParameterSize,
+			QuantizationLevel: m.Details.QuantizationLevel,
+		})
+	}
+	return models, nil
+}
+
+// ListModels is a Wails-bindable method that returns the models installed on the
+// configured Ollama server.
+func (a *App) ListModels() ([]ModelInfo, error) {
+	models, err := a.listModels(a.ctx)
+	if err != nil {
+		log.Printf("Error listing models: %v", err)
+		return nil, fmt.Errorf("could not list models: %w", err)
+	}
+	return models, nil
+}
+
+// ShowModel is a Wails-bindable method that returns details of an installed model,
+// such as its context window and default parameters.
+func (a *App) ShowModel(name string) (ModelDetails, error) {
+	var show ollamaShowResponse
+	if err := a.ollamaJSON(a.ctx, "show", map[string]string{"model": name}, &show); err != nil {
+		log.Printf("Error showing model %s: %v", name, err)
+		return ModelDetails{}, fmt.Errorf("could not show model %s: %w", name, err)
+	}
+	details := ModelDetails{
+		Name:              name,
+		Family:            show.Details.Family,
+		Format:            show.Details.Format,
+		ParameterSize:     show.Details.ParameterSize,
+		QuantizationLevel: show.Details.QuantizationLevel,
+		Parameters:        show.Parameters,
+		Template:          show.Template,
+	}
+	for key, value := range show.ModelInfo {
+		number, ok := value.(float64) // JSON numbers decode as float64
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(key, ".context_length"):
+			details.ContextLength = int(number)
+		case strings.HasSuffix(key, ".embedding_length"):
+			details.EmbeddingLength = int(number)
+		}
+	}
+	return details, nil
+}
+
+// PullModel is a Wails-bindable method that starts downloading a model in the
+// background. Progress arrives as modelPullEvent events; the last one has Done set.
+// It returns an error if the same model is already being pulled.
+func (a *App) PullModel(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("model name must not be empty")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, running := a.pulls[name]; running {
+		return fmt.Errorf("model %s is already being pulled", name)
+	}
+	pullCtx, cancel := context.WithCancel(a.ctx)
+	a.pulls[name] = cancel
+	go a.runPull(pullCtx, name)
+	log.Printf("Started pulling model %s", name)
+	return nil
+}
+
+// CancelPull is a Wails-bindable method that stops pulling a model. Ollama keeps the
+// layers downloaded so far, so a later PullModel resumes. It reports whether a pull
+// of the model was running.
+func (a *App) CancelPull(name string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cancel, ok := a.pulls[name]
+	if ok {
+		log.Printf("CancelPull called. Stopping pull of %s.", name)
+		cancel()
+	}
+	return ok
+}
+
+// runPull streams /api/pull for a model and forwards its progress as events.
+func (a *App) runPull(ctx context.Context, name string) {
+	final := ModelPullEvent{Model: name, Done: true}
+	defer func() {
+		a.mu.Lock()
+		if cancel, ok := a.pulls[name]; ok {
+			cancel()
+			delete(a.pulls, name)
+		}
+		a.mu.Unlock()
+		runtime.EventsEmit(a.ctx, "modelPullEvent", final)
+		if final.Error == "" {
+			log.Printf("Pulled model %s", name)
+			a.recheckHealth() // The missing-model warning may be resolved now
+		}
+	}()
+
+	jsonBody, err := json.Marshal(map[string]interface{}{"model": name, "stream": true})
+	if err != nil {
+		final.Error = fmt.Sprintf("could not process pull request (marshal): %v", err)
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.ollamaURL("pull"), bytes.NewReader(jsonBody))
+	if err != nil {
+		final.Error = fmt.Sprintf("could not create pull request: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		final.Error = fmt.Sprintf("could not connect to Ollama service: %v", err)
+		if ctx.Err() != nil {
+			final.Error = "pull cancelled"
+		}
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		final.Error = fmt.Sprintf("ollama pull API error (%s): %s", resp.Status, strings.TrimSpace(string(bodyBytes)))
+		return
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var progress ollamaPullProgress
+		if err := json.Unmarshal(scanner.Bytes(), &progress); err != nil {
+			continue // Skip malformed progress lines; the final status decides the outcome
+		}
+		if progress.Error != "" {
+			final.Error = progress.Error
+			return
+		}
+		event := ModelPullEvent{
+			Model:     name,
+			Status:    progress.Status,
+			Digest:    progress.Digest,
+			Total:     progress.Total,
+			Completed: progress.Completed,
+		}
+		if progress.Total > 0 {
+			event.Percent = float64(progress.Completed) / float64(progress.Total) * 100
+		}
+		final.Status = progress.Status
+		runtime.EventsEmit(a.ctx, "modelPullEvent", event)
+	}
+	if ctx.Err() != nil {
+		final.Error = "pull cancelled"
+		return
+	}
+	if err := scanner.Err(); err != nil {
+		final.Error = fmt.Sprintf("error reading pull progress: %v", err)
+		return
+	}
+	if final.Status != "success" {
+		final.Error = fmt.Sprintf("pull ended with status %q", final.Status)
+	}
+}
+
+// checkModels verifies that the configured chat and embedding models are installed.
+func (a *App) checkModels() ModelCheck {
+	settings := a.currentSettings()
+	check := ModelCheck{ChatModel: settings.ChatModel, EmbeddingModel: settings.EmbeddingModel, Missing: []string{}}
+
+	ctx, cancel := context.WithTimeout(a.ctx, modelCheckTimeout)
+	defer cancel()
+	models, err := a.listModels(ctx)
+	if err != nil {
+		check.Message = fmt.Sprintf("Ollama is not reachable at %s (%v). Start Ollama or change the server in the settings.", settings.OllamaURL, err)
+		return check
+	}
+	check.Reachable = true
+	for _, m := range models {
+		check.ChatModelInstalled = check.ChatModelInstalled || modelNameMatches(settings.ChatModel, m.Name)
+		check.EmbeddingModelInstalled = check.EmbeddingModelInstalled || modelNameMatches(settings.EmbeddingModel, m.Name)
+	}
+	if !check.ChatModelInstalled {
+		check.Missing = append(check.Missing, settings.ChatModel)
+	}
+	if !check.EmbeddingModelInstalled && !modelNameMatches(settings.EmbeddingModel, settings.ChatModel) {
+		check.Missing = append(check.Missing, settings.EmbeddingModel)
+	}
+	if len(check.Missing) > 0 {
+		check.Message = fmt.Sprintf("Model(s) %s are not installed on %s. Pull them from the app or run `ollama pull %s`, or pick installed models in the settings.",
+			strings.Join(check.Missing, ", "), settings.OllamaURL, strings.Join(check.Missing, "` and `ollama pull "))
+	}
+	return check
+}
+
+// CheckModels is a Wails-bindable method that verifies that the configured chat and
+// embedding models are installed, with an actionable message if they are not.
+func (a *App) CheckModels() ModelCheck {
+	return a.checkModels()
+}
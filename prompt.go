@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+)
+
+const defaultPromptTemplateName = "clinical-qa" // Template used when neither the conversation nor the settings pick one
+
+// PromptTemplate turns retrieved context and a question into the messages sent to the
+// chat model. The two message templates use Go text/template syntax with the fields
+// of PromptData, for example {{.Context}}, {{.Sources}} and {{.Question}}.
+type PromptTemplate struct {
+	Name              string `json:"name"`  // Unique identifier, referenced by settings and conversations
+	Title             string `json:"title"` // Display name, e.g. "Clinical Q&A"
+	SystemPrompt      string `json:"systemPrompt"`
+	ContextTemplate   string `json:"contextTemplate"`   // User message when context was retrieved
+	NoContextTemplate string `json:"noContextTemplate"` // User message when no context was found
+}
+
+// PromptData is what the message templates of a PromptTemplate can refer to.
+type PromptData struct {
+	Question string        // The user's question as typed
+	Context  string        // All chunks, each with a header naming its source, separated by ---
+	Sources  string        // One line per chunk: "- report.pdf p.3 (chunk 12, relevance 0.83)"
+	Chunks   []PromptChunk // The chunks one by one, for templates that lay them out themselves
+}
+
+// PromptChunk is one retrieved chunk as seen by a template.
+type PromptChunk struct {
+	Source  string  // File name and page, as in sourceLabel
+	ChunkID int     // ID of the chunk in the vector store
+	Score   float64 // Relevance to the question
+	Date    string  // Document date as YYYY-MM-DD, or "" if unknown
+	Text    string
+}
+
+// defaultPromptTemplates returns the built-in templates.
+func defaultPromptTemplates() []PromptTemplate {
+	const contextTemplate = `Use the following context from the user's documents to answer the question.
+
+{{.Context}}
+
+Sources:
+{{.Sources}}
+
+Question: {{.Question}}`
+
+	return []PromptTemplate{
+		{
+			Name:  "clinical-qa",
+			Title: "Clinical Q&A",
+			SystemPrompt: "You are a clinical assistant for healthcare professionals. Answer using the context from the user's documents when it is provided, and name the documents you used. " +
+				"If the context does not contain the answer, say so instead of guessing. Never invent values, doses or dates. Be concise and precise.",
+			ContextTemplate:   contextTemplate,
+			NoContextTemplate: "{{.Question}}",
+		},
+		{
+			Name:  "patient-summary",
+			Title: "Summarise for patient",
+			SystemPrompt: "You explain medical information to patients. Write in plain, friendly language a non-specialist understands, explain any medical term you have to use, and keep sentences short. " +
+				"Only use facts from the provided context; do not add diagnoses or treatment advice that are not in it, and suggest asking the care team about anything unclear.",
+			ContextTemplate: `Summarise the following information for the patient, answering their request.
+
+{{.Context}}
+
+Request: {{.Question}}`,
+			NoContextTemplate: "{{.Question}}",
+		},
+		{
+			Name:  "differential-diagnosis",
+			Title: "Differential diagnosis",
+			SystemPrompt: "You support a clinician in building a differential diagnosis. List the plausible diagnoses from most to least likely. For each, give the findings from the context that support and argue against it, " +
+				"and the examinations or tests that would tell them apart. Point out red flags that need urgent action. This is decision support: the clinician makes the diagnosis.",
+			ContextTemplate: `Case information:
+
+{{.Context}}
+
+Sources:
+{{.Sources}}
+
+Question: {{.Question}}`,
+			NoContextTemplate: "{{.Question}}",
+		},
+	}
+}
+
+// validatePromptTemplates checks that template names are unique and the message
+// templates parse, and that defaultName refers to one of them.
+func validatePromptTemplates(templates []PromptTemplate, defaultName string) error {
+	if len(templates) == 0 {
+		return errors.New("at least one prompt template is required")
+	}
+	names := make(map[string]bool, len(templates))
+	for _, t := range templates {
+		if strings.TrimSpace(t.Name) == "" {
+			return errors.New("prompt template names must not be empty")
+		}
+		if names[t.Name] {
+			return fmt.Errorf("prompt template name %q is used twice", t.Name)
+		}
+		names[t.Name] = true
+		if strings.TrimSpace(t.ContextTemplate) == "" || strings.TrimSpace(t.NoContextTemplate) == "" {
+			return fmt.Errorf("prompt template %q needs both a context and a no-context template", t.Name)
+		}
+		// Render with sample data, so unknown fields are caught now rather than on a question.
+		sample := newPromptData("sample question", []DocumentChunk{{ID: 1, Text: "sample context", SourceFile: "sample.txt", Score: 1}})
+		if _, err := t.render(sample); err != nil {
+			return err
+		}
+		sample.Chunks = nil
+		if _, err := t.render(sample); err != nil {
+			return err
+		}
+	}
+	if !names[defaultName] {
+		return fmt.Errorf("default prompt template %q does not exist", defaultName)
+	}
+	return nil
+}
+
+// promptTemplate returns the template with the given name, falling back to the default
+// template from the settings when the name is empty or unknown.
+func (a *App) promptTemplate(name string) PromptTemplate {
+	settings := a.currentSettings()
+	var fallback PromptTemplate
+	for _, t := range settings.Templates {
+		if t.Name == name && name != "" {
+			return t
+		}
+		if t.Name == settings.DefaultTemplate {
+			fallback = t
+		}
+	}
+	if name != "" {
+		log.Printf("Prompt template %q not found. Using %q.", name, fallback.Name)
+	}
+	return fallback
+}
+
+// newPromptData prepares the template data for a question and its retrieved chunks.
+func newPromptData(question string, chunks []DocumentChunk) PromptData {
+	data := PromptData{Question: question}
+	var contextBuilder, sourcesBuilder strings.Builder
+	for i, chunk := range chunks {
+		label := sourceLabel(chunk)
+		data.Chunks = append(data.Chunks, PromptChunk{Source: label, ChunkID: chunk.ID, Score: chunk.Score, Date: chunk.Metadata.Date, Text: chunk.Text})
+		if i > 0 {
+			contextBuilder.WriteString("\n\n---\n\n") // Separator between chunks
+			sourcesBuilder.WriteString("\n")
+		}
+		// The date lets the model tell the latest of several reports apart
+		dated := ""
+		if chunk.Metadata.Date != "" {
+			dated = " dated " + chunk.Metadata.Date
+		}
+		contextBuilder.WriteString(fmt.Sprintf("Context from document '%s'%s (Chunk %d, Relevance: %.2f):\n", label, dated, chunk.ID, chunk.Score))
+		contextBuilder.WriteString(chunk.Text)
+		sourcesBuilder.WriteString(fmt.Sprintf("- %s (chunk %d, relevance %.2f)", label, chunk.ID, chunk.Score))
+	}
+	data.Context = contextBuilder.String()
+	data.Sources = sourcesBuilder.String()
+	return data
+}
+
+// render builds the user message for a question, using the context template when
+// chunks were retrieved and the no-context template otherwise.
+func (t PromptTemplate) render(data PromptData) (string, error) {
+	text := t.NoContextTemplate
+	if len(data.Chunks) > 0 {
+		text = t.ContextTemplate
+	}
+	tmpl, err := template.New(t.Name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("could not parse prompt template %q: %w", t.Name, err)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("could not render prompt template %q: %w", t.Name, err)
+	}
+	return out.String(), nil
+}
+
+// buildMessages assembles the chat request: the template's system message, the
+// conversation history and the rendered question. If the template fails to render,
+// the bare question is sent so the user still gets an answer.
+func (t PromptTemplate) buildMessages(history []OllamaChatMessage, data PromptData) []OllamaChatMessage {
+	prompt, err := t.render(data)
+	if err != nil {
+		log.Printf("Error rendering prompt: %v. Sending the question without context.", err)
+		prompt = data.Question
+	}
+	messages := make([]OllamaChatMessage, 0, len(history)+2)
+	if strings.TrimSpace(t.SystemPrompt) != "" {
+		messages = append(messages, OllamaChatMessage{Role: "system", Content: t.SystemPrompt})
+	}
+	messages = append(messages, history...)
+	return append(messages, OllamaChatMessage{Role: "user", Content: prompt})
+}
+
+// SetConversationTemplate is a Wails-bindable method that selects the prompt template
+// used for the next answers of a conversation. An empty name goes back to the default
+// template from the settings.
+func (a *App) SetConversationTemplate(conversationID string, name string) error {
+	if name != "" {
+		found := false
+		for _, t := range a.currentSettings().Templates {
+			found = found || t.Name == name
+		}
+		if !found {
+			return fmt.Errorf("prompt template %q does not exist", name)
+		}
+	}
+	conv := a.conversation(conversationID)
+	conv.mu.Lock()
+	defer conv.mu.Unlock()
+	conv.Template = name
+	log.Printf("Conversation %s now uses prompt template %q", conv.ID, name)
+	if len(conv.Messages) == 0 {
+		return nil // Saved with its first turn
+	}
+	return conv.saveLocked()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidatePromptTemplates(t *testing.T) {
+	valid := PromptTemplate{Name: "custom", ContextTemplate: "{{.Context}}\n\n{{.Question}}", NoContextTemplate: "{{.Question}}"}
+	with := func(change func(*PromptTemplate)) []PromptTemplate {
+		tmpl := valid
+		change(&tmpl)
+		return []PromptTemplate{tmpl}
+	}
+	tests := []struct {
+		name        string
+		templates   []PromptTemplate
+		defaultName string
+		wantErr     string
+	}{
+		{"built-in templates", defaultPromptTemplates(), defaultPromptTemplateName, ""},
+		{"custom template", []PromptTemplate{valid}, "custom", ""},
+		{"chunks laid out by the template", with(func(t *PromptTemplate) {
+			t.ContextTemplate = "{{range .Chunks}}[{{.Source}} {{.Date}}] {{.Text}}\n{{end}}{{.Question}}"
+		}), "custom", ""},
+		{"none", nil, "custom", "at least one prompt template"},
+		{"empty name", with(func(t *PromptTemplate) { t.Name = " " }), "custom", "names must not be empty"},
+		{"duplicate name", []PromptTemplate{valid, valid}, "custom", `"custom" is used twice`},
+		{"missing no-context template", with(func(t *PromptTemplate) { t.NoContextTemplate = "" }), "custom", "needs both"},
+		{"syntax error", with(func(t *PromptTemplate) { t.ContextTemplate = "{{.Question" }), "custom", "could not parse"},
+		{"unknown field", with(func(t *PromptTemplate) { t.ContextTemplate = "{{.Patient}}" }), "custom", "could not render"},
+		{"chunk field in no-context template", with(func(t *PromptTemplate) { t.NoContextTemplate = "{{(index .Chunks 0).Text}}" }), "custom", "could not render"},
+		{"unknown default", []PromptTemplate{valid}, "other", `default prompt template "other" does not exist`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePromptTemplates(tt.templates, tt.defaultName)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validatePromptTemplates() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validatePromptTemplates() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPromptTemplateRender(t *testing.T) {
+	tmpl := PromptTemplate{
+		Name:              "test",
+		ContextTemplate:   "{{.Context}}\nSources:\n{{.Sources}}\nQuestion: {{.Question}}",
+		NoContextTemplate: "Question: {{.Question}}",
+	}
+	chunks := []DocumentChunk{
+		{ID: 3, SourceFile: "echo.pdf", Page: 2, Score: 0.8, Text: "LVEF 55%.", Metadata: ChunkMetadata{Date: "2023-02-05"}},
+		{ID: 9, SourceFile: "labs.txt", Score: 0.5, Text: "Hb 13.5 g/dL."},
+	}
+	tests := []struct {
+		name   string
+		tmpl   PromptTemplate
+		chunks []DocumentChunk
+		want   string
+	}{
+		{"no context", tmpl, nil, "Question: Latest LVEF?"},
+		{"context", tmpl, chunks, "Context from document '" + sourceLabel(chunks[0]) + "' dated 2023-02-05 (Chunk 3, Relevance: 0.80):\nLVEF 55%." +
+			"\n\n---\n\nContext from document 'labs.txt' (Chunk 9, Relevance: 0.50):\nHb 13.5 g/dL." +
+			"\nSources:\n- " + sourceLabel(chunks[0]) + " (chunk 3, relevance 0.80)\n- labs.txt (chunk 9, relevance 0.50)" +
+			"\nQuestion: Latest LVEF?"},
+		{"chunks one by one", PromptTemplate{Name: "list", ContextTemplate: "{{range .Chunks}}{{.ChunkID}}:{{.Date}};{{end}}", NoContextTemplate: "-"}, chunks, "3:2023-02-05;9:;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.tmpl.render(newPromptData("Latest LVEF?", tt.chunks))
+			if err != nil {
+				t.Fatalf("render() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildMessagesFallsBackToQuestion(t *testing.T) {
+	tmpl := PromptTemplate{Name: "broken", SystemPrompt: "Be brief.", ContextTemplate: "{{.Patient}}", NoContextTemplate: "{{.Question}}"}
+	history := []OllamaChatMessage{{Role: "user", Content: "Hello"}, {Role: "assistant", Content: "Hi"}}
+	data := newPromptData("Latest LVEF?", []DocumentChunk{{ID: 1, SourceFile: "echo.pdf", Text: "LVEF 55%."}})
+	// Unknown fields fail when the template is executed, not when it is parsed
+	if _, err := tmpl.render(data); err == nil || !strings.Contains(err.Error(), `could not render prompt template "broken"`) {
+		t.Fatalf("render() error = %v, want the template named", err)
+	}
+	messages := tmpl.buildMessages(history, data)
+	if len(messages) != 4 || messages[0].Role != "system" || messages[0].Content != "Be brief." {
+		t.Fatalf("buildMessages() = %+v, want the system prompt, history and question", messages)
+	}
+	if last := messages[3]; last.Role != "user" || last.Content != "Latest LVEF?" {
+		t.Errorf("last message = %+v, want the bare question", last)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRerankCandidates = 10   // Chunks retrieved for re-ranking, of which the best top N are kept
+	maxRerankCandidates     = 50   // Upper bound accepted by RetrievalOptions validation; each costs a model call
+	defaultRerankMinScore   = 0.3  // Minimum re-rank score for a chunk to be sent, a rating of 3 out of 10
+	rerankConcurrency       = 4    // Ratings requested at once; Ollama queues requests beyond its parallelism
+	rerankMaxTokens         = 4    // Answer length allowed for a relevance rating
+	rerankMaxChunkRunes     = 2000 // Chunk text sent per relevance prompt
+)
+
+// rerankPrompt asks a model to rate how well a passage answers a question.
+const rerankPrompt = `You judge whether a passage from a patient's medical documents helps to answer a question.
+Rate the passage from 0 (unrelated) to 10 (answers the question directly). Reply with the number only.
+
+Question: %s
+
+Passage:
+%s
+
+Rating:`
+
+// rerankRatingPattern finds the rating in a model reply.
+var rerankRatingPattern = regexp.MustCompile(`\d+(\.\d+)?`)
+
+// parseRerankRating turns a reply to rerankPrompt into a score between 0 and 1.
+func parseRerankRating(reply string) (float64, error) {
+	match := rerankRatingPattern.FindString(reply)
+	if match == "" {
+		return 0, fmt.Errorf("no rating in reply %q", reply)
+	}
+	rating, err := strconv.ParseFloat(match, 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse rating %q: %w", match, err)
+	}
+	return math.Min(math.Max(rating, 0), 10) / 10, nil
+}
+
+// rerankChunk asks the re-ranking model how relevant a chunk is to the question, keeping
+// the model loaded as long as options ask. A reply without a rating scores 0; only a
+// failed request is an error.
+func (a *App) rerankChunk(ctx context.Context, options GenerationOptions, model, question string, chunk DocumentChunk) (float64, error) {
+	text := chunk.Text
+	if runes := []rune(text); len(runes) > rerankMaxChunkRunes {
+		text = string(runes[:rerankMaxChunkRunes])
+	}
+	temperature, numPredict := 0.0, rerankMaxTokens
+	var resp OllamaChatResponse
+	err := a.ollamaJSON(ctx, "chat", OllamaChatRequest{
+		Model:     model,
+		Messages:  []OllamaChatMessage{{Role: "user", Content: fmt.Sprintf(rerankPrompt, question, text)}},
+		Options:   &ollamaOptions{Temperature: &temperature, NumPredict: &numPredict},
+		KeepAlive: options.ollamaKeepAlive(),
+	}, &resp)
+	if err != nil {
+		return 0, err
+	}
+	score, err := parseRerankRating(resp.Message.Content)
+	if err != nil {
+		log.Printf("Could not rate chunk %d: %v. Scoring it 0.", chunk.ID, err)
+	}
+	return score, nil
+}
+
+// rerankChunks scores every candidate against the question with the re-ranking model
+// (RerankModel, or the chat model if none is set) and returns them ordered by that
+// score; selectChunks then keeps the best. Up to rerankConcurrency ratings are requested
+// at once, with the keep-alive of gen. If the model cannot be reached, the candidates
+// keep their retrieval order.
+func (a *App) rerankChunks(gen *generation, question string, candidates []DocumentChunk, options RetrievalOptions) []DocumentChunk {
+	if len(candidates) == 0 {
+		return candidates
+	}
+	model := options.RerankModel
+	if model == "" {
+		model = a.currentSettings().ChatModel
+	}
+
+	start := time.Now()
+	reranked := make([]DocumentChunk, len(candidates))
+	copy(reranked, candidates)
+
+	// The first failure stops the remaining ratings, since the order is kept anyway.
+	rateCtx, cancel := context.WithCancel(gen.ctx)
+	defer cancel()
+	type rating struct {
+		pos   int
+		score float64
+		err   error
+	}
+	positions := make(chan int)
+	ratings := make(chan rating)
+	var wg sync.WaitGroup
+	for w := 0; w < min(rerankConcurrency, len(reranked)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pos := range positions {
+				r := rating{pos: pos}
+				if r.err = rateCtx.Err(); r.err == nil {
+					r.score, r.err = a.rerankChunk(rateCtx, gen.options, model, question, reranked[pos])
+				}
+				ratings <- r
+			}
+		}()
+	}
+	go func() {
+		for pos := range reranked {
+			positions <- pos
+		}
+		close(positions)
+		wg.Wait()
+		close(ratings)
+	}()
+
+	var failed *rating
+	for r := range ratings {
+		if r.err != nil {
+			if failed == nil {
+				failed = &r
+				cancel()
+			}
+			continue
+		}
+		reranked[r.pos].RerankScore = r.score
+		reranked[r.pos].Reranked = true
+	}
+	if gen.ctx.Err() != nil {
+		return candidates
+	}
+	if failed != nil {
+		log.Printf("Error re-ranking chunk %d with %s: %v. Keeping the retrieval order.", reranked[failed.pos].ID, model, failed.err)
+		return candidates
+	}
+	sort.SliceStable(reranked, func(i, j int) bool {
+		return reranked[i].RerankScore > reranked[j].RerankScore
+	})
+	log.Printf("Re-ranked %d chunks with %s in %v.", len(reranked), model, time.Since(start))
+	return reranked
+}
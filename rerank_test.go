@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor blocks until condition holds, failing the test after a few seconds.
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// ratingHandler answers relevance prompts with the rating written in the passage, as
+// "rating N", counting the requests in flight at once.
+type ratingHandler struct {
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	keepAlives  []interface{} // keep_alive of each request
+	release     chan struct{} // Closed to let the requests answer
+	fail        string        // Passage text answered with a server error
+}
+
+func (h *ratingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.inFlight++
+	h.maxInFlight = max(h.maxInFlight, h.inFlight)
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		h.inFlight--
+		h.mu.Unlock()
+	}()
+	<-h.release
+
+	var req OllamaChatRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	h.mu.Lock()
+	h.keepAlives = append(h.keepAlives, req.KeepAlive)
+	h.mu.Unlock()
+	prompt := req.Messages[0].Content
+	if h.fail != "" && strings.Contains(prompt, h.fail) {
+		http.Error(w, "model crashed", http.StatusInternalServerError)
+		return
+	}
+	_, rating, _ := strings.Cut(prompt, "rating ")
+	json.NewEncoder(w).Encode(OllamaChatResponse{Message: OllamaChatMessage{Role: "assistant", Content: strings.Fields(rating)[0]}})
+}
+
+func TestRerankChunks(t *testing.T) {
+	candidates := []DocumentChunk{
+		{ID: 1, Text: "rating 2", Score: 0.9},
+		{ID: 2, Text: "rating 9", Score: 0.8},
+		{ID: 3, Text: "rating 5", Score: 0.7},
+		{ID: 4, Text: "rating 0", Score: 0.6},
+		{ID: 5, Text: "rating 7", Score: 0.5},
+		{ID: 6, Text: "rating 3", Score: 0.4},
+	}
+	tests := []struct {
+		name    string
+		fail    string
+		wantIDs []int
+	}{
+		{"ordered by rating", "", []int{2, 5, 3, 6, 1, 4}},
+		{"failed rating keeps retrieval order", "rating 5", []int{1, 2, 3, 4, 5, 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &ratingHandler{release: make(chan struct{}), fail: tt.fail}
+			a := newTestApp(t, handler.ServeHTTP)
+			a.settings.Generation.KeepAlive = "1m"
+			close(handler.release)
+
+			// The request's keep-alive overrides the settings, as for the answer itself
+			gen := &generation{ctx: context.Background(), options: GenerationOptions{KeepAlive: "10m"}}
+			reranked := a.rerankChunks(gen, "question", candidates, defaultRetrievalOptions())
+			var ids []int
+			for _, chunk := range reranked {
+				ids = append(ids, chunk.ID)
+				if chunk.Reranked != (tt.fail == "") {
+					t.Errorf("chunk %d Reranked = %t", chunk.ID, chunk.Reranked)
+				}
+			}
+			for _, keepAlive := range handler.keepAlives {
+				if keepAlive != "10m" {
+					t.Errorf("rating requested with keep_alive %v, want the request's 10m", keepAlive)
+				}
+			}
+			if len(ids) != len(tt.wantIDs) {
+				t.Fatalf("rerankChunks() order = %v, want %v", ids, tt.wantIDs)
+			}
+			for i := range ids {
+				if ids[i] != tt.wantIDs[i] {
+					t.Fatalf("rerankChunks() order = %v, want %v", ids, tt.wantIDs)
+				}
+			}
+		})
+	}
+}
+
+func TestRerankChunksBoundsConcurrency(t *testing.T) {
+	handler := &ratingHandler{release: make(chan struct{})}
+	a := newTestApp(t, handler.ServeHTTP)
+	candidates := make([]DocumentChunk, 3*rerankConcurrency)
+	for i := range candidates {
+		candidates[i] = DocumentChunk{ID: i, Text: "rating 5"}
+	}
+
+	done := make(chan []DocumentChunk)
+	go func() {
+		done <- a.rerankChunks(&generation{ctx: context.Background()}, "question", candidates, defaultRetrievalOptions())
+	}()
+	waitFor(t, func() bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+		return handler.inFlight == rerankConcurrency
+	})
+	close(handler.release)
+	<-done
+	if handler.maxInFlight != rerankConcurrency {
+		t.Errorf("%d ratings requested at once, want %d", handler.maxInFlight, rerankConcurrency)
+	}
+}
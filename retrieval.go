@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultRetrievalTopN     = 3   // Chunks retrieved per question
+	maxRetrievalTopN         = 20  // Upper bound accepted by RetrievalOptions validation
+	defaultRetrievalMinScore = 0.5 // Minimum cosine similarity for a chunk to be sent to the model in vector mode
+	defaultKeywordMinScore   = 0.2 // Minimum normalised BM25 score in keyword mode; one matching term in a chunk of average length scores about 0.45
+	defaultHybridMinScore    = 0.3 // Minimum fused score in hybrid mode; a chunk found by one retriever only scores at most 0.5 with RRF
+	defaultKeywordWeight     = 0.3 // Share of the keyword score in weighted hybrid fusion
+	hybridCandidateFactor    = 4   // Hybrid retrieval fuses this many times top N candidates from each retriever
+	rrfK                     = 60  // Reciprocal rank fusion constant; larger values flatten the rank weights
+)
+
+// Retrieval modes.
+const (
+	retrievalVector  = "vector"  // Embedding similarity only
+	retrievalKeyword = "keyword" // BM25 keyword match only
+	retrievalHybrid  = "hybrid"  // Both, fused
+)
+
+// Hybrid fusion methods.
+const (
+	fusionRRF      = "rrf"      // Reciprocal rank fusion: combines ranks, ignoring score scales
+	fusionWeighted = "weighted" // Weighted sum of similarity and normalised BM25 score
+)
+
+// Reasons a retrieved chunk was not sent to the model, shown with its source.
+const (
+	skipBelowMinScore   = "below minimum score"
+	skipBelowCutoff     = "too far below the best score"
+	skipContextOverflow = "did not fit into the context window"
+)
+
+// RetrievalOptions controls how chunks are retrieved and which of them are sent to the
+// model as context.
+type RetrievalOptions struct {
+	Mode string `json:"mode"` // "vector", "keyword" or "hybrid"
+	// Fusion combines the two rankings in hybrid mode: "rrf" or "weighted".
+	Fusion        string  `json:"fusion"`
+	KeywordWeight float64 `json:"keywordWeight"` // Share of the keyword score with weighted fusion, 0 to 1
+	TopN          int     `json:"topN"`          // Chunks retrieved per question
+	// MinScore is the cosine similarity every chunk sent must reach in vector mode.
+	// Keyword and hybrid scores lie between 0 and 1 on other scales, so those modes
+	// have their own minimum.
+	MinScore        float64 `json:"minScore"`
+	KeywordMinScore float64 `json:"keywordMinScore"` // Minimum normalised BM25 score in keyword mode
+	HybridMinScore  float64 `json:"hybridMinScore"`  // Minimum fused score in hybrid mode
+	RerankMinScore  float64 `json:"rerankMinScore"`  // Minimum re-rank score, replacing the mode's minimum for re-ranked chunks
+	// RelativeCutoff drops chunks scoring more than this below the best chunk, so weak
+	// matches are not sent along with a strong one. 0 disables the cutoff.
+	RelativeCutoff float64 `json:"relativeCutoff"`
+	// Rerank retrieves RerankCandidates chunks, has a model rate each against the
+	// question and keeps the best TopN. It costs one model call per candidate.
+	Rerank           bool   `json:"rerank"`
+	RerankModel      string `json:"rerankModel"` // Ollama model rating the chunks; empty uses the chat model
+	RerankCandidates int    `json:"rerankCandidates"`
+	// MMRLambda trades relevance against diversity when picking the top N: 1 ranks by
+	// relevance alone, lower values increasingly skip chunks similar to ones already
+	// picked, such as the overlapping neighbours of a chunk.
+	MMRLambda        float64 `json:"mmrLambda"`
+	MaxChunksPerFile int     `json:"maxChunksPerFile"` // Most chunks taken from one source file; 0 for no limit
+}
+
+// defaultRetrievalOptions returns the retrieval options used until the user changes them.
+func defaultRetrievalOptions() RetrievalOptions {
+	return RetrievalOptions{
+		Mode:             retrievalVector,
+		Fusion:           fusionRRF,
+		KeywordWeight:    defaultKeywordWeight,
+		TopN:             defaultRetrievalTopN,
+		MinScore:         defaultRetrievalMinScore,
+		KeywordMinScore:  defaultKeywordMinScore,
+		HybridMinScore:   defaultHybridMinScore,
+		RerankMinScore:   defaultRerankMinScore,
+		RerankCandidates: defaultRerankCandidates,
+		MMRLambda:        defaultMMRLambda,
+	}
+}
+
+// candidates returns how many chunks to retrieve before re-ranking, diversifying and
+// filtering.
+func (o RetrievalOptions) candidates() int {
+	if o.Rerank {
+		return max(o.TopN, o.RerankCandidates)
+	}
+	if o.diversify() {
+		return o.TopN * mmrCandidateFactor
+	}
+	return o.TopN
+}
+
+// validate checks that the options are usable. Scores lie between -1 and 1.
+func (o RetrievalOptions) validate() error {
+	switch o.Mode {
+	case retrievalVector, retrievalKeyword, retrievalHybrid:
+	default:
+		return fmt.Errorf("mode %q must be %q, %q or %q", o.Mode, retrievalVector, retrievalKeyword, retrievalHybrid)
+	}
+	if o.Fusion != fusionRRF && o.Fusion != fusionWeighted {
+		return fmt.Errorf("fusion %q must be %q or %q", o.Fusion, fusionRRF, fusionWeighted)
+	}
+	if o.KeywordWeight < 0 || o.KeywordWeight > 1 {
+		return fmt.Errorf("keyword weight must be between 0 and 1")
+	}
+	if o.TopN < 1 || o.TopN > maxRetrievalTopN {
+		return fmt.Errorf("top N must be between 1 and %d", maxRetrievalTopN)
+	}
+	if o.MinScore < -1 || o.MinScore > 1 {
+		return fmt.Errorf("minimum score must be between -1 and 1")
+	}
+	if o.KeywordMinScore < 0 || o.KeywordMinScore > 1 || o.HybridMinScore < 0 || o.HybridMinScore > 1 || o.RerankMinScore < 0 || o.RerankMinScore > 1 {
+		return fmt.Errorf("keyword, hybrid and re-rank minimum scores must be between 0 and 1")
+	}
+	if o.RelativeCutoff < 0 || o.RelativeCutoff > 2 {
+		return fmt.Errorf("relative cutoff must be between 0 and 2")
+	}
+	if o.RerankCandidates < 1 || o.RerankCandidates > maxRerankCandidates {
+		return fmt.Errorf("re-rank candidates must be between 1 and %d", maxRerankCandidates)
+	}
+	if o.MMRLambda < 0 || o.MMRLambda > 1 {
+		return fmt.Errorf("MMR lambda must be between 0 and 1")
+	}
+	if o.MaxChunksPerFile < 0 {
+		return fmt.Errorf("max chunks per file must not be negative")
+	}
+	if strings.ContainsAny(o.RerankModel, " \t\r\n") {
+		return fmt.Errorf("re-rank model %q must not contain spaces", o.RerankModel)
+	}
+	return nil
+}
+
+// fuseRankings merges the best chunks by similarity and by keyword match into one
+// ranking of topN chunks. vector must carry VectorScore and keyword both VectorScore
+// and KeywordScore; a chunk missing from keyword has no keyword score worth counting.
+// With RRF, Score is divided by its maximum so a chunk ranked first by both scores 1.
+func fuseRankings(vector, keyword []DocumentChunk, options RetrievalOptions, topN int) []DocumentChunk {
+	fused := make(map[int]*DocumentChunk, len(vector)+len(keyword))
+	var order []int
+	add := func(chunks []DocumentChunk) {
+		for rank, chunk := range chunks {
+			entry, ok := fused[chunk.ID]
+			if !ok {
+				entry = &chunk
+				entry.Score = 0
+				fused[chunk.ID] = entry
+				order = append(order, chunk.ID)
+			}
+			entry.KeywordScore = max(entry.KeywordScore, chunk.KeywordScore)
+			if options.Fusion == fusionRRF {
+				entry.Score += 1 / float64(rrfK+rank+1)
+			}
+		}
+	}
+	add(vector)
+	add(keyword)
+
+	results := make([]DocumentChunk, 0, len(fused))
+	for _, id := range order {
+		chunk := *fused[id]
+		if options.Fusion == fusionRRF {
+			chunk.Score /= 2 / float64(rrfK+1)
+		} else {
+			chunk.Score = (1-options.KeywordWeight)*chunk.VectorScore + options.KeywordWeight*chunk.KeywordScore
+		}
+		results = append(results, chunk)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results[:min(topN, len(results))]
+}
+
+// minScore returns the minimum score for the retrieval mode.
+func (o RetrievalOptions) minScore() float64 {
+	switch o.Mode {
+	case retrievalKeyword:
+		return o.KeywordMinScore
+	case retrievalHybrid:
+		return o.HybridMinScore
+	default:
+		return o.MinScore
+	}
+}
+
+// minScoreFor returns the minimum score of a chunk: RerankMinScore if the re-ranking
+// model rated it, the minimum of the retrieval mode otherwise.
+func (o RetrievalOptions) minScoreFor(chunk DocumentChunk) float64 {
+	if chunk.Reranked {
+		return o.RerankMinScore
+	}
+	return o.minScore()
+}
+
+// skipReason returns why a chunk should not be sent to the model, or "" if it should.
+// best is the relevance of the best retrieved chunk.
+func (o RetrievalOptions) skipReason(chunk DocumentChunk, best float64) string {
+	if chunk.relevance() < o.minScoreFor(chunk) {
+		return skipBelowMinScore
+	}
+	if o.RelativeCutoff > 0 && best-chunk.relevance() > o.RelativeCutoff {
+		return skipBelowCutoff
+	}
+	return ""
+}
+
+// filterChunks returns the retrieved chunks that pass the options, best first, and
+// the reason each of the others was skipped, keyed by chunk ID. Re-ranked chunks are
+// judged by their re-rank score, which replaced the retrieval score in their order.
+func (o RetrievalOptions) filterChunks(chunks []DocumentChunk) ([]DocumentChunk, map[int]string) {
+	kept := make([]DocumentChunk, 0, len(chunks))
+	skipped := make(map[int]string)
+	if len(chunks) == 0 {
+		return kept, skipped
+	}
+	best := chunks[0].relevance()
+	for _, chunk := range chunks {
+		best = max(best, chunk.relevance())
+	}
+	for _, chunk := range chunks {
+		if reason := o.skipReason(chunk, best); reason != "" {
+			log.Printf("Not sending chunk %d from %s (score %.4f): %s", chunk.ID, chunk.SourceFile, chunk.relevance(), reason)
+			skipped[chunk.ID] = reason
+			continue
+		}
+		kept = append(kept, chunk)
+	}
+	return kept, skipped
+}
+
+// sourceInfos describes the retrieved chunks for the frontend, marking the ones that
+// were sent to the model. Chunks neither sent nor in skipped were dropped for space.
+func sourceInfos(retrieved, sent []DocumentChunk, skipped map[int]string) []SourceInfo {
+	sentIDs := make(map[int]bool, len(sent))
+	for _, chunk := range sent {
+		sentIDs[chunk.ID] = true
+	}
+	infos := make([]SourceInfo, 0, len(retrieved))
+	for _, chunk := range retrieved {
+		info := SourceInfo{
+			FileName: chunk.SourceFile,
+			Page:     chunk.Page,
+			ChunkID:  chunk.ID,
+			Score:    chunk.Score,
+			Sent:     sentIDs[chunk.ID],
+		}
+		if chunk.KeywordScore > 0 && chunk.VectorScore != 0 {
+			info.VectorScore = chunk.VectorScore
+			info.KeywordScore = chunk.KeywordScore
+		}
+		if chunk.Reranked {
+			rerankScore := chunk.RerankScore
+			info.RerankScore = &rerankScore
+		}
+		if !info.Sent {
+			info.SkipReason = skipped[chunk.ID]
+			if info.SkipReason == "" {
+				info.SkipReason = skipContextOverflow
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// GetRetrievalOptions is a Wails-bindable method that returns the current retrieval options.
+func (a *App) GetRetrievalOptions() RetrievalOptions {
+	return a.currentSettings().Retrieval
+}
+
+// SetRetrievalOptions is a Wails-bindable method that replaces the retrieval options
+// used from the next question on. The options are saved with the settings.
+func (a *App) SetRetrievalOptions(options RetrievalOptions) error {
+	if err := a.updateSettings(func(s *Settings) { s.Retrieval = options }); err != nil {
+		return err
+	}
+	log.Printf("Retrieval options updated: %+v", options)
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import "testing"
+
+// newTestStore returns a memory store holding one file per text, with the given
+// embeddings (nil for none).
+func newTestStore(texts []string, embeddings [][]float32) *VectorStore {
+	store := newMemoryVectorStore()
+	for i, text := range texts {
+		chunk := DocumentChunk{Text: text}
+		if embeddings != nil {
+			chunk.Embedding = embeddings[i]
+		}
+		store.ReplaceFile(FileRecord{SourceFile: text}, []DocumentChunk{chunk})
+	}
+	return store
+}
+
+func TestDefaultOptionsSendKeywordMatches(t *testing.T) {
+	texts := []string{
+		"Metformin 500 mg twice daily for type 2 diabetes.",
+		"Blood pressure was 130/85 at the last visit.",
+		"The patient reports occasional headaches in the morning.",
+		"Follow-up appointment scheduled with cardiology in March.",
+	}
+	embeddings := [][]float32{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}, {0.6, 0.8, 0}}
+
+	tests := []struct {
+		name  string
+		mode  string
+		query string
+		// queryEmbedding is orthogonal to the chunk with the keyword in hybrid mode,
+		// so it is found by the keyword retriever only.
+		queryEmbedding []float32
+		want           string
+	}{
+		{"keyword", retrievalKeyword, "metformin", nil, texts[0]},
+		{"keyword among common words", retrievalKeyword, "what about the headaches", nil, texts[2]},
+		{"hybrid keyword only", retrievalHybrid, "metformin", []float32{0, 0, 1}, texts[0]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestStore(texts, embeddings)
+			options := defaultRetrievalOptions()
+			options.Mode = tt.mode
+
+			retrieved := store.Search(tt.queryEmbedding, tt.query, options, chunkFilter{})
+			sent, skipped := options.filterChunks(retrieved)
+			for _, chunk := range sent {
+				if chunk.Text == tt.want {
+					return
+				}
+			}
+			t.Errorf("chunk %q not sent; retrieved %d chunks, skipped %v", tt.want, len(retrieved), skipped)
+		})
+	}
+}
+
+func TestMinScoreFollowsMode(t *testing.T) {
+	options := RetrievalOptions{MinScore: 0.5, KeywordMinScore: 0.2, HybridMinScore: 0.3}
+	for mode, want := range map[string]float64{retrievalVector: 0.5, retrievalKeyword: 0.2, retrievalHybrid: 0.3} {
+		options.Mode = mode
+		if got := options.minScore(); got != want {
+			t.Errorf("minScore() in %s mode = %v, want %v", mode, got, want)
+		}
+	}
+}
+
+func TestFilterChunksUsesRerankScore(t *testing.T) {
+	options := defaultRetrievalOptions()
+	options.RelativeCutoff = 0.5
+	chunks := []DocumentChunk{
+		{ID: 1, Score: 0.2, RerankScore: 0.9, Reranked: true},  // Weak match rated relevant
+		{ID: 2, Score: 0.9, RerankScore: 0.1, Reranked: true},  // Strong match rated unrelated
+		{ID: 3, Score: 0.9, RerankScore: 0.35, Reranked: true}, // Too far below the best rating
+		{ID: 4, Score: 0.6}, // Not re-ranked: judged by its score
+	}
+	sent, skipped := options.filterChunks(chunks)
+	if len(sent) != 2 || sent[0].ID != 1 || sent[1].ID != 4 {
+		t.Errorf("sent %v, want chunks 1 and 4", sent)
+	}
+	if skipped[2] != skipBelowMinScore || skipped[3] != skipBelowCutoff {
+		t.Errorf("skipped = %v, want chunk 2 below the minimum and 3 below the cutoff", skipped)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	sessionsDirName       = "sessions" // Sub-directory of the app data directory holding one JSON file per session
+	sessionTitleMaxRunes  = 60         // Length of titles derived from the first question
+	sessionSnippetContext = 40         // Runes shown on each side of a search match
+)
+
+// SessionSummary describes a saved session in the session list.
+type SessionSummary struct {
+	ID           string `json:"id"`
+	Title        string `json:"title"`
+	CreatedAt    string `json:"createdAt"` // RFC 3339
+	UpdatedAt    string `json:"updatedAt"` // RFC 3339
+	MessageCount int    `json:"messageCount"`
+}
+
+// SessionSearchResult is a session matching a SearchSessions query.
+type SessionSearchResult struct {
+	SessionSummary
+	Snippet string `json:"snippet"` // Text around the first match
+}
+
+// sessionTitle derives a session title from its first question.
+func sessionTitle(question string) string {
+	title := strings.Join(strings.Fields(question), " ")
+	if utf8.RuneCountInString(title) > sessionTitleMaxRunes {
+		title = string([]rune(title)[:sessionTitleMaxRunes-1]) + "…"
+	}
+	return title
+}
+
+// sessionPath returns the file of the session with the given ID in dir, or "" if there
+// is no dir or the ID is not a plain name. IDs come from the frontend, so they must not
+// be able to name a file elsewhere.
+func sessionPath(dir, id string) string {
+	if dir == "" || id == "" || id != filepath.Base(id) || strings.ContainsAny(id, `/\:`) {
+		return ""
+	}
+	return filepath.Join(dir, id+".json")
+}
+
+// saveLocked writes the session file. The caller must hold c.mu.
+func (c *Conversation) saveLocked() error {
+	if c.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(c.Session, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode session: %w", err)
+	}
+	if err := writeFileAtomic(c.path, data); err != nil {
+		return fmt.Errorf("could not save session: %w", err)
+	}
+	return nil
+}
+
+// summary returns the list entry for the conversation.
+func (c *Conversation) summary() SessionSummary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.summaryLocked()
+}
+
+// summaryLocked is summary for callers that hold c.mu.
+func (c *Conversation) summaryLocked() SessionSummary {
+	return SessionSummary{
+		ID:           c.ID,
+		Title:        c.Title,
+		CreatedAt:    c.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:    c.UpdatedAt.Format(time.RFC3339),
+		MessageCount: len(c.Messages),
+	}
+}
+
+// loadSessions reads every saved session from dir into a.conversations and makes
+// new sessions persist there. Unreadable files are logged and skipped.
+func (a *App) loadSessions(dir string) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		log.Printf("Error creating sessions directory %s: %v. Chats will only be kept in memory.", dir, err)
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Printf("Error reading sessions directory %s: %v. Chats will only be kept in memory.", dir, err)
+		return
+	}
+
+	a.convMu.Lock()
+	defer a.convMu.Unlock()
+	a.sessionsDir = dir
+	loaded := 0
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Error reading session %s: %v. Skipping.", path, err)
+			continue
+		}
+		var session Session
+		if err := json.Unmarshal(data, &session); err != nil || session.ID == "" {
+			log.Printf("Error decoding session %s: %v. Skipping.", path, err)
+			continue
+		}
+		// A session is saved back to the file it came from, so its ID must be that file's name.
+		if session.ID != strings.TrimSuffix(entry.Name(), ".json") {
+			log.Printf("Session %s has ID %q, which does not match its file name. Skipping.", path, session.ID)
+			continue
+		}
+		a.conversations[session.ID] = &Conversation{Session: session, path: path}
+		loaded++
+	}
+	// Conversations started before the directory was known (none in practice) persist from now on.
+	for id, conv := range a.conversations {
+		if conv.path == "" {
+			conv.path = sessionPath(dir, id)
+		}
+	}
+	log.Printf("Loaded %d saved chat sessions from %s", loaded, dir)
+}
+
+// savedConversations returns the conversations that have at least one turn, most
+// recently updated first. Empty conversations are not listed until they are used.
+func (a *App) savedConversations() []*Conversation {
+	a.convMu.Lock()
+	convs := make([]*Conversation, 0, len(a.conversations))
+	for _, conv := range a.conversations {
+		convs = append(convs, conv)
+	}
+	a.convMu.Unlock()
+
+	updated := make(map[*Conversation]time.Time, len(convs))
+	nonEmpty := convs[:0]
+	for _, conv := range convs {
+		conv.mu.Lock()
+		empty := len(conv.Messages) == 0
+		updated[conv] = conv.UpdatedAt
+		conv.mu.Unlock()
+		if !empty {
+			nonEmpty = append(nonEmpty, conv)
+		}
+	}
+	sort.Slice(nonEmpty, func(i, j int) bool {
+		return updated[nonEmpty[i]].After(updated[nonEmpty[j]])
+	})
+	return nonEmpty
+}
+
+// ListSessions is a Wails-bindable method that returns the saved chat sessions, most
+// recently updated first.
+func (a *App) ListSessions() []SessionSummary {
+	convs := a.savedConversations()
+	summaries := make([]SessionSummary, 0, len(convs))
+	for _, conv := range convs {
+		summaries = append(summaries, conv.summary())
+	}
+	return summaries
+}
+
+// OpenSession is a Wails-bindable method that returns a saved session with all its
+// messages, sources and metrics. The ID can then be passed to HandleMessage to
+// continue the conversation.
+func (a *App) OpenSession(id string) (Session, error) {
+	a.convMu.Lock()
+	conv, ok := a.conversations[id]
+	a.convMu.Unlock()
+	if !ok {
+		return Session{}, fmt.Errorf("could not open session %s: not found", id)
+	}
+	conv.mu.Lock()
+	defer conv.mu.Unlock()
+	session := conv.Session
+	session.Messages = append([]SessionMessage(nil), conv.Messages...) // Copy, as the conversation keeps growing
+	return session, nil
+}
+
+// RenameSession is a Wails-bindable method that changes the title of a session.
+func (a *App) RenameSession(id string, title string) error {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return errors.New("session title must not be empty")
+	}
+	a.convMu.Lock()
+	conv, ok := a.conversations[id]
+	a.convMu.Unlock()
+	if !ok {
+		return fmt.Errorf("could not rename session %s: not found", id)
+	}
+	conv.mu.Lock()
+	defer conv.mu.Unlock()
+	conv.Title = title
+	if len(conv.Messages) == 0 {
+		return nil // Saved with its first turn
+	}
+	return conv.saveLocked()
+}
+
+// DeleteSession is a Wails-bindable method that removes a session and its file.
+func (a *App) DeleteSession(id string) error {
+	a.convMu.Lock()
+	conv, ok := a.conversations[id]
+	delete(a.conversations, id)
+	a.convMu.Unlock()
+	if !ok {
+		return fmt.Errorf("could not delete session %s: not found", id)
+	}
+
+	conv.mu.Lock()
+	defer conv.mu.Unlock()
+	if conv.path != "" {
+		if err := os.Remove(conv.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("could not delete session file %s: %w", conv.path, err)
+		}
+		conv.path = "" // An answer still streaming into it must not recreate the file
+	}
+	log.Printf("Deleted session %s", id)
+	return nil
+}
+
+// SearchSessions is a Wails-bindable method that finds sessions whose title or
+// messages contain query, ignoring case. Results are most recently updated first.
+func (a *App) SearchSessions(query string) []SessionSearchResult {
+	query = strings.TrimSpace(query)
+	results := []SessionSearchResult{}
+	if query == "" {
+		return results
+	}
+	needle := strings.ToLower(query)
+	for _, conv := range a.savedConversations() {
+		conv.mu.Lock()
+		result := SessionSearchResult{SessionSummary: conv.summaryLocked()}
+		found := strings.Contains(strings.ToLower(conv.Title), needle)
+		if found {
+			result.Snippet = conv.Title
+		}
+		for _, msg := range conv.Messages {
+			if snippet, ok := matchSnippet(msg.Content, needle); ok {
+				result.Snippet = snippet // A message is a more useful snippet than the title
+				found = true
+				break
+			}
+		}
+		conv.mu.Unlock()
+		if found {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// matchSnippet returns the text around the first case-insensitive occurrence of the
+// lower-case needle in text.
+func matchSnippet(text, needle string) (string, bool) {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	needleRunes := []rune(needle)
+	if len(lower) != len(runes) { // Lower-casing changed the length; fall back to a plain check
+		if !strings.Contains(strings.ToLower(text), needle) {
+			return "", false
+		}
+		return sessionTitle(text), true
+	}
+	idx := strings.Index(string(lower), needle)
+	if idx < 0 {
+		return "", false
+	}
+	start := utf8.RuneCountInString(string(lower)[:idx])
+	end := start + len(needleRunes)
+	from := max(0, start-sessionSnippetContext)
+	to := min(len(runes), end+sessionSnippetContext)
+	snippet := strings.Join(strings.Fields(string(runes[from:to])), " ")
+	if from > 0 {
+		snippet = "…" + snippet
+	}
+	if to < len(runes) {
+		snippet += "…"
+	}
+	return snippet, true
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSessionPath(t *testing.T) {
+	dir := filepath.Join("data", "sessions")
+	tests := []struct {
+		name string
+		dir  string
+		id   string
+		want string
+	}{
+		{"plain ID", dir, "abc123", filepath.Join(dir, "abc123.json")},
+		{"no directory", "", "abc123", ""},
+		{"empty ID", dir, "", ""},
+		{"parent directory", dir, "../settings", ""},
+		{"sub-directory", dir, "a/b", ""},
+		{"backslash", dir, `..\settings`, ""},
+		{"drive", dir, "C:evil", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sessionPath(tt.dir, tt.id); got != tt.want {
+				t.Errorf("sessionPath(%q, %q) = %q, want %q", tt.dir, tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadSessionsChecksIDs(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"good.json":     `{"id": "good", "title": "Kept"}`,
+		"renamed.json":  `{"id": "other", "title": "ID of another file"}`,
+		"escape.json":   `{"id": "../../settings", "title": "ID outside the folder"}`,
+		"no-id.json":    `{"title": "No ID"}`,
+		"broken.json":   `{"id": `,
+		"notes.txt":     `{"id": "notes"}`,
+		"settings.json": `{"id": "good", "title": "Duplicate ID"}`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := NewApp()
+	a.loadSessions(dir)
+	if len(a.conversations) != 1 {
+		t.Fatalf("loaded %d sessions, want only the valid one", len(a.conversations))
+	}
+	conv := a.conversations["good"]
+	if conv == nil || conv.Title != "Kept" || conv.path != filepath.Join(dir, "good.json") {
+		t.Fatalf("session good = %+v, want it loaded from and saved to good.json", conv)
+	}
+
+	a.convMu.Lock()
+	escaped := a.newConversationLocked("../escaped")
+	a.convMu.Unlock()
+	if escaped.path != "" {
+		t.Errorf("conversation with ID %q saved to %q", escaped.ID, escaped.path)
+	}
+}
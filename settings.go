@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	settingsFileName      = "settings.json"          // File name of the persisted settings in the app data directory
+	defaultOllamaURL      = "http://localhost:11434" // Ollama server used until the user configures another one
+	defaultChatModel      = "llama3"                 // Model for chat completions
+	defaultEmbeddingModel = "nomic-embed-text"       // Model for generating embeddings
+)
+
+// Settings is the user configuration of the application. It is stored as JSON in the
+// app data directory and can be changed at runtime with UpdateSettings.
+type Settings struct {
+	OllamaURL       string             `json:"ollamaUrl"` // Base URL of the Ollama server, without the /api suffix
+	ChatModel       string             `json:"chatModel"`
+	EmbeddingModel  string             `json:"embeddingModel"` // Changing it makes the existing index stale
+	Load            LoadOptions        `json:"load"`
+	Chat            ChatOptions        `json:"chat"`
+	Retrieval       RetrievalOptions   `json:"retrieval"`
+	VectorIndex     VectorIndexOptions `json:"vectorIndex"`
+	Generation      GenerationOptions  `json:"generation"`      // Defaults for every answer; HandleMessageWithOptions overrides them
+	Templates       []PromptTemplate   `json:"templates"`       // Prompt templates conversations can choose from
+	DefaultTemplate string             `json:"defaultTemplate"` // Name of the template used unless a conversation picks another
+}
+
+// IndexStatus describes the document index, emitted as indexStatus when it changes.
+type IndexStatus struct {
+	Chunks         int    `json:"chunks"`
+	EmbeddingModel string `json:"embeddingModel"` // Model the stored vectors were computed with
+	Stale          bool   `json:"stale"`          // The configured embedding model differs; documents must be reloaded
+	Message        string `json:"message,omitempty"`
+}
+
+// defaultSettings returns the settings used when no settings file exists.
+func defaultSettings() Settings {
+	return Settings{
+		OllamaURL:       defaultOllamaURL,
+		ChatModel:       defaultChatModel,
+		EmbeddingModel:  defaultEmbeddingModel,
+		Load:            defaultLoadOptions(),
+		Chat:            defaultChatOptions(),
+		Retrieval:       defaultRetrievalOptions(),
+		VectorIndex:     defaultVectorIndexOptions(),
+		Templates:       defaultPromptTemplates(),
+		DefaultTemplate: defaultPromptTemplateName,
+	}
+}
+
+// normalize tidies user input: surrounding spaces, trailing slashes and an /api suffix
+// on the server URL are removed.
+func (s *Settings) normalize() {
+	s.OllamaURL = strings.TrimRight(strings.TrimSpace(s.OllamaURL), "/")
+	s.OllamaURL = strings.TrimRight(strings.TrimSuffix(s.OllamaURL, "/api"), "/")
+	s.ChatModel = strings.TrimSpace(s.ChatModel)
+	s.EmbeddingModel = strings.TrimSpace(s.EmbeddingModel)
+	s.Retrieval.Mode = strings.ToLower(strings.TrimSpace(s.Retrieval.Mode))
+	s.Retrieval.Fusion = strings.ToLower(strings.TrimSpace(s.Retrieval.Fusion))
+	s.Retrieval.RerankModel = strings.TrimSpace(s.Retrieval.RerankModel)
+	s.VectorIndex.Type = strings.ToLower(strings.TrimSpace(s.VectorIndex.Type))
+	s.Generation.normalize()
+}
+
+// validate checks that the settings are usable.
+func (s Settings) validate() error {
+	parsed, err := url.Parse(s.OllamaURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("ollama URL %q must be an http or https URL such as %s", s.OllamaURL, defaultOllamaURL)
+	}
+	for name, model := range map[string]string{"chat model": s.ChatModel, "embedding model": s.EmbeddingModel} {
+		if model == "" {
+			return fmt.Errorf("%s must not be empty", name)
+		}
+		if strings.ContainsAny(model, " \t\r\n") {
+			return fmt.Errorf("%s %q must not contain spaces", name, model)
+		}
+	}
+	if err := s.Load.validate(); err != nil {
+		return fmt.Errorf("invalid load options: %w", err)
+	}
+	if err := s.Chat.validate(); err != nil {
+		return fmt.Errorf("invalid chat options: %w", err)
+	}
+	if err := s.Retrieval.validate(); err != nil {
+		return fmt.Errorf("invalid retrieval options: %w", err)
+	}
+	if err := s.VectorIndex.validate(); err != nil {
+		return fmt.Errorf("invalid vector index options: %w", err)
+	}
+	if err := s.Generation.validate(); err != nil {
+		return fmt.Errorf("invalid generation options: %w", err)
+	}
+	if err := validatePromptTemplates(s.Templates, s.DefaultTemplate); err != nil {
+		return fmt.Errorf("invalid prompt templates: %w", err)
+	}
+	return nil
+}
+
+// loadSettings reads the settings file at path. Fields missing from the file keep
+// their defaults, and a missing file yields the defaults.
+func loadSettings(path string) (Settings, error) {
+	settings := defaultSettings()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("No settings file found at %s. Using default settings.", path)
+		return settings, nil
+	}
+	if err != nil {
+		return settings, fmt.Errorf("could not read settings %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return defaultSettings(), fmt.Errorf("could not parse settings %s: %w", path, err)
+	}
+	settings.normalize()
+	if err := settings.validate(); err != nil {
+		return defaultSettings(), fmt.Errorf("invalid settings in %s: %w", path, err)
+	}
+	log.Printf("Loaded settings from %s.", path)
+	return settings, nil
+}
+
+// currentSettings returns a copy of the settings in effect.
+func (a *App) currentSettings() Settings {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.settings
+}
+
+// ollamaURL returns the URL of an Ollama API endpoint, such as "chat", on the
+// configured server.
+func (a *App) ollamaURL(endpoint string) string {
+	return a.currentSettings().OllamaURL + "/api/" + endpoint
+}
+
+// GetSettings is a Wails-bindable method returning the current settings.
+func (a *App) GetSettings() Settings {
+	return a.currentSettings()
+}
+
+// UpdateSettings is a Wails-bindable method that validates, saves and applies new
+// settings. They take effect immediately: the next request uses the new server and
+// models. Changing the embedding model marks the document index as stale.
+func (a *App) UpdateSettings(settings Settings) error {
+	return a.updateSettings(func(s *Settings) { *s = settings })
+}
+
+// updateSettings applies change to a copy of the current settings, then validates,
+// saves and applies the result.
+func (a *App) updateSettings(change func(*Settings)) error {
+	a.mu.Lock()
+	previous := a.settings
+	settings := a.settings
+	settings.Load.IncludePatterns = append([]string(nil), previous.Load.IncludePatterns...)
+	settings.Load.ExcludePatterns = append([]string(nil), previous.Load.ExcludePatterns...)
+	settings.Load.TagRules = append([]TagRule(nil), previous.Load.TagRules...)
+	settings.Generation.Stop = append([]string(nil), previous.Generation.Stop...)
+	settings.Templates = append([]PromptTemplate(nil), previous.Templates...)
+	change(&settings)
+	settings.normalize()
+	if err := settings.validate(); err != nil {
+		a.mu.Unlock()
+		log.Printf("Rejected settings: %v", err)
+		return err
+	}
+	a.settings = settings
+	a.settingsVersion++
+	version, path := a.settingsVersion, a.settingsPath
+	a.mu.Unlock()
+
+	log.Printf("Settings updated: ollamaUrl=%s chatModel=%s embeddingModel=%s", settings.OllamaURL, settings.ChatModel, settings.EmbeddingModel)
+	a.limiter.setLimit(settings.Chat.MaxConcurrentGenerations)
+	if settings.EmbeddingModel != previous.EmbeddingModel {
+		a.emitIndexStatus()
+	}
+	if settings.VectorIndex != previous.VectorIndex {
+		a.store.ConfigureIndex(settings.VectorIndex)
+	}
+	if settings.OllamaURL != previous.OllamaURL || settings.ChatModel != previous.ChatModel || settings.EmbeddingModel != previous.EmbeddingModel {
+		a.recheckHealth()
+	}
+
+	if path == "" {
+		return nil // Settings could not be located; they only last until the app closes
+	}
+	// Concurrent updates may reach this point out of order; the file must end up
+	// holding the settings in effect, not whichever write came last.
+	a.saveMu.Lock()
+	defer a.saveMu.Unlock()
+	if version < a.savedVersion {
+		return nil // Newer settings were saved already
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode settings: %w", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("settings applied but could not be saved: %w", err)
+	}
+	a.savedVersion = version
+	return nil
+}
+
+// indexStatus describes the document index against the current settings.
+func (a *App) indexStatus() IndexStatus {
+	status := IndexStatus{
+		Chunks:         a.store.Len(),
+		EmbeddingModel: a.store.EmbeddingModel(),
+	}
+	configured := a.currentSettings().EmbeddingModel
+	if status.Chunks > 0 && status.EmbeddingModel != configured {
+		status.Stale = true
+		status.Message = fmt.Sprintf("The document index was built with %s but the embedding model is now %s. Load your documents again to rebuild it; until then answers use keyword-only retrieval.",
+			status.EmbeddingModel, configured)
+	}
+	return status
+}
+
+// indexStale reports whether the stored vectors come from another embedding model
+// than the configured one, so they can't be compared with new query embeddings.
+func (a *App) indexStale() bool {
+	return a.indexStatus().Stale
+}
+
+// GetIndexStatus is a Wails-bindable method returning the state of the document index.
+func (a *App) GetIndexStatus() IndexStatus {
+	return a.indexStatus()
+}
+
+// emitIndexStatus sends the current index status to the frontend.
+func (a *App) emitIndexStatus() {
+	status := a.indexStatus()
+	if status.Stale {
+		log.Println(status.Message)
+	}
+	runtime.EventsEmit(a.ctx, "indexStatus", status)
+}
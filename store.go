@@ -0,0 +1,719 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	appDataDirName           = "medical-awp"      // Directory name under the user config dir holding persisted data
+	vectorStoreFileName      = "vectorstore.json" // File name of the persisted vector store
+	vectorStoreSchemaVersion = 5                  // Current on-disk schema version of the vector store
+)
+
+// FileRecord tracks the state of a source file at the time it was indexed,
+// so unchanged files can be skipped on the next load.
+type FileRecord struct {
+	SourceFile  string           `json:"source_file"`
+	ContentHash string           `json:"content_hash"` // Hex-encoded SHA-256 of the file content
+	ModTime     time.Time        `json:"mod_time"`
+	Size        int64            `json:"size"`
+	Metadata    DocumentMetadata `json:"metadata"` // Title, author, date and page count reported by the extractor
+	Header      HeaderMetadata   `json:"header"`   // Patient ID and date found in the start of the text
+}
+
+// vectorStoreFile is the on-disk representation of the vector store.
+type vectorStoreFile struct {
+	SchemaVersion  int                   `json:"schema_version"`
+	NextDocumentID int                   `json:"next_document_id"`
+	Chunks         []DocumentChunk       `json:"chunks"`
+	Files          map[string]FileRecord `json:"files"`
+	EmbeddingModel string                `json:"embedding_model,omitempty"` // Model the embeddings were computed with; empty in older files
+}
+
+// vectorStoreMigrations upgrades a decoded store file from the keyed schema version
+// to the next one. Add an entry here whenever vectorStoreSchemaVersion is bumped.
+var vectorStoreMigrations = map[int]func(raw map[string]json.RawMessage) error{
+	// Version 1 had no file records. Starting with an empty set makes the next load
+	// re-index every file once, after which unchanged files are skipped.
+	1: func(raw map[string]json.RawMessage) error {
+		raw["files"] = json.RawMessage("{}")
+		return nil
+	},
+	// Version 2 kept embeddings as Ollama returned them. From version 3 on they are
+	// float32 scaled to unit length, so cosine similarity is a dot product.
+	2: func(raw map[string]json.RawMessage) error {
+		return migrateChunks(raw, func(chunk map[string]json.RawMessage) error {
+			if len(chunk["embedding"]) == 0 {
+				return nil // Chunk without an embedding
+			}
+			var embedding []float64
+			if err := json.Unmarshal(chunk["embedding"], &embedding); err != nil {
+				return fmt.Errorf("could not parse embedding: %w", err)
+			}
+			unit, err := json.Marshal(unitEmbedding(embedding))
+			chunk["embedding"] = unit
+			return err
+		})
+	},
+	// Version 3 chunks carried no metadata. It is derived from the path, the file
+	// record and the first chunk of each file; tags and the patient folder of the load
+	// options are applied when the documents are next loaded.
+	3: func(raw map[string]json.RawMessage) error {
+		var files map[string]FileRecord
+		if err := json.Unmarshal(raw["files"], &files); err != nil {
+			return fmt.Errorf("could not parse file records: %w", err)
+		}
+		metadata := make(map[string]json.RawMessage)
+		return migrateChunks(raw, func(chunk map[string]json.RawMessage) error {
+			var sourceFile, text string
+			json.Unmarshal(chunk["source_file"], &sourceFile) // A missing field leaves it empty
+			json.Unmarshal(chunk["text"], &text)
+			if _, ok := metadata[sourceFile]; !ok {
+				encoded, err := json.Marshal(chunkMetadataFor(sourceFile, files[sourceFile].Metadata, headerMetadataOf(text), LoadOptions{}))
+				if err != nil {
+					return err
+				}
+				metadata[sourceFile] = encoded
+			}
+			chunk["metadata"] = metadata[sourceFile]
+			return nil
+		})
+	},
+	// Version 4 file records did not keep what the start of the text said, so
+	// refreshing the metadata of an unchanged file relied on its first chunk alone.
+	// The header is rebuilt from the chunks of each file in order, as documentHeader
+	// builds it from the pages.
+	4: func(raw map[string]json.RawMessage) error {
+		var files map[string]FileRecord
+		if err := json.Unmarshal(raw["files"], &files); err != nil {
+			return fmt.Errorf("could not parse file records: %w", err)
+		}
+		var chunks []struct {
+			ID         int    `json:"id"`
+			Text       string `json:"text"`
+			SourceFile string `json:"source_file"`
+		}
+		if err := json.Unmarshal(raw["chunks"], &chunks); err != nil {
+			return fmt.Errorf("could not parse chunks: %w", err)
+		}
+		sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].ID < chunks[j].ID })
+		headers := make(map[string]*strings.Builder)
+		for _, chunk := range chunks {
+			header := headers[chunk.SourceFile]
+			if header == nil {
+				header = &strings.Builder{}
+				headers[chunk.SourceFile] = header
+			}
+			if header.Len() < metadataHeaderRunes {
+				header.WriteString(chunk.Text)
+				header.WriteString("\n")
+			}
+		}
+		for sourceFile, header := range headers {
+			record, ok := files[sourceFile]
+			if !ok {
+				continue // Chunks without a record are re-indexed on the next load anyway
+			}
+			text := header.String()
+			if runes := []rune(text); len(runes) > metadataHeaderRunes {
+				text = string(runes[:metadataHeaderRunes])
+			}
+			record.Header = headerMetadataOf(text)
+			files[sourceFile] = record
+		}
+		encoded, err := json.Marshal(files)
+		if err != nil {
+			return fmt.Errorf("could not encode file records: %w", err)
+		}
+		raw["files"] = encoded
+		return nil
+	},
+}
+
+// migrateChunks applies migrate to every chunk of a raw store file.
+func migrateChunks(raw map[string]json.RawMessage, migrate func(chunk map[string]json.RawMessage) error) error {
+	var chunks []map[string]json.RawMessage
+	if err := json.Unmarshal(raw["chunks"], &chunks); err != nil {
+		return fmt.Errorf("could not parse chunks: %w", err)
+	}
+	for i, chunk := range chunks {
+		if err := migrate(chunk); err != nil {
+			return fmt.Errorf("could not migrate chunk %d: %w", i, err)
+		}
+	}
+	encoded, err := json.Marshal(chunks)
+	if err != nil {
+		return fmt.Errorf("could not encode chunks: %w", err)
+	}
+	raw["chunks"] = encoded
+	return nil
+}
+
+// VectorStore holds document chunks and their embeddings and persists them to disk.
+// It is safe for concurrent use.
+type VectorStore struct {
+	path           string // Location of the store file; empty means memory only
+	chunks         []DocumentChunk
+	files          map[string]FileRecord // Indexed source files keyed by SourceFile
+	nextDocumentID int
+	embeddingModel string           // Model the stored embeddings were computed with
+	keywords       *keywordIndex    // BM25 index over the chunk texts, rebuilt on load
+	positions      map[int]int      // Index into chunks, keyed by chunk ID
+	fileChunks     map[string][]int // IDs of each source file's chunks
+	index          *hnswIndex       // Approximate nearest-neighbour index; nil scans every chunk
+	indexOptions   VectorIndexOptions
+	dirty          bool // Chunks, records or the embedding model changed since the store file was written
+	indexDirty     bool // The graph changed, was rebuilt or was disabled since the index file was written
+	mu             sync.RWMutex
+}
+
+// appDataDir returns the per-user directory where the application keeps its data,
+// creating it if it does not exist yet.
+func appDataDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("could not determine user config directory: %w", err)
+	}
+	dir := filepath.Join(configDir, appDataDirName)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("could not create app data directory %s: %w", dir, err)
+	}
+	return dir, nil
+}
+
+// newMemoryVectorStore creates an empty store that is never written to disk.
+func newMemoryVectorStore() *VectorStore {
+	store := &VectorStore{
+		chunks:         make([]DocumentChunk, 0),
+		files:          make(map[string]FileRecord),
+		nextDocumentID: 1,
+	}
+	store.reindexLocked()
+	return store
+}
+
+// reindexLocked rebuilds the keyword index and chunk positions from s.chunks.
+// The caller must hold s.mu for writing or own the store exclusively.
+func (s *VectorStore) reindexLocked() {
+	s.keywords = newKeywordIndex(s.chunks)
+	s.updatePositionsLocked()
+}
+
+// updatePositionsLocked recomputes s.positions and s.fileChunks after chunks were moved.
+func (s *VectorStore) updatePositionsLocked() {
+	s.positions = make(map[int]int, len(s.chunks))
+	s.fileChunks = make(map[string][]int, len(s.files))
+	for i, chunk := range s.chunks {
+		s.positions[chunk.ID] = i
+		s.fileChunks[chunk.SourceFile] = append(s.fileChunks[chunk.SourceFile], chunk.ID)
+	}
+}
+
+// openVectorStore loads the store persisted at path, migrating it to the current
+// schema version if needed. A missing file yields an empty store bound to path.
+func openVectorStore(path string) (*VectorStore, error) {
+	store := newMemoryVectorStore()
+	store.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("No vector store found at %s. Starting with an empty store.", path)
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read vector store %s: %w", path, err)
+	}
+
+	file, readVersion, err := decodeVectorStoreFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("could not load vector store %s: %w", path, err)
+	}
+
+	store.chunks = file.Chunks
+	if store.chunks == nil {
+		store.chunks = make([]DocumentChunk, 0)
+	}
+	if file.Files != nil {
+		store.files = file.Files
+	}
+	store.embeddingModel = file.EmbeddingModel
+	store.nextDocumentID = file.NextDocumentID
+	if store.nextDocumentID < 1 {
+		store.nextDocumentID = 1
+	}
+	store.reindexLocked()
+	log.Printf("Loaded %d chunks from vector store %s (schema version %d).", len(store.chunks), path, file.SchemaVersion)
+
+	// Write the migrated store back, so migrations run once rather than on every start.
+	if readVersion < vectorStoreSchemaVersion {
+		if err := store.writeStoreLocked(); err != nil {
+			return nil, fmt.Errorf("could not save migrated vector store %s: %w", path, err)
+		}
+	}
+	return store, nil
+}
+
+// decodeVectorStoreFile parses raw store data, running the migrations needed to
+// bring it up to vectorStoreSchemaVersion. It also returns the schema version the
+// data was written with.
+func decodeVectorStoreFile(data []byte) (*vectorStoreFile, int, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, 0, fmt.Errorf("could not parse store file: %w", err)
+	}
+
+	version := 0
+	if v, ok := raw["schema_version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return nil, 0, fmt.Errorf("could not parse schema version: %w", err)
+		}
+	}
+	if version > vectorStoreSchemaVersion {
+		return nil, 0, fmt.Errorf("store schema version %d is newer than supported version %d", version, vectorStoreSchemaVersion)
+	}
+
+	readVersion := version
+	for version < vectorStoreSchemaVersion {
+		migrate, ok := vectorStoreMigrations[version]
+		if !ok {
+			return nil, 0, fmt.Errorf("no migration available from schema version %d", version)
+		}
+		if err := migrate(raw); err != nil {
+			return nil, 0, fmt.Errorf("migration from schema version %d failed: %w", version, err)
+		}
+		version++
+		log.Printf("Migrated vector store to schema version %d.", version)
+	}
+
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not re-encode migrated store: %w", err)
+	}
+	var file vectorStoreFile
+	if err := json.Unmarshal(migrated, &file); err != nil {
+		return nil, 0, fmt.Errorf("could not decode store file: %w", err)
+	}
+	file.SchemaVersion = version
+	return &file, readVersion, nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it over
+// path, so readers never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return fmt.Errorf("could not write %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("could not replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// Save writes the store and its vector index to disk if they changed since they were
+// last written, so reloading an unchanged folder does not rewrite a large store. The
+// files are replaced atomically so a crash mid-write never leaves a truncated store
+// behind.
+func (s *VectorStore) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.path == "" {
+		return nil // Memory-only store
+	}
+	if s.dirty {
+		if err := s.writeStoreLocked(); err != nil {
+			return err
+		}
+		s.dirty = false
+	}
+	if !s.indexDirty {
+		return nil
+	}
+
+	// The graph is saved with the chunks it indexes. Without one, a leftover file is
+	// removed so it is never loaded against chunks it does not describe.
+	if s.index == nil {
+		if err := os.Remove(s.indexPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("could not remove outdated vector index: %w", err)
+		}
+	} else if err := s.index.save(s.indexPath(), s.embeddingModel); err != nil {
+		return fmt.Errorf("could not write vector index: %w", err)
+	}
+	s.indexDirty = false
+	return nil
+}
+
+// writeStoreLocked writes the chunks and file records, without the vector index, to
+// s.path. The caller must hold s.mu or own the store exclusively.
+func (s *VectorStore) writeStoreLocked() error {
+	data, err := json.Marshal(vectorStoreFile{
+		SchemaVersion:  vectorStoreSchemaVersion,
+		NextDocumentID: s.nextDocumentID,
+		Chunks:         s.chunks,
+		Files:          s.files,
+		EmbeddingModel: s.embeddingModel,
+	})
+	if err != nil {
+		return fmt.Errorf("could not encode vector store: %w", err)
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("could not write vector store: %w", err)
+	}
+	log.Printf("Saved %d chunks to vector store %s.", len(s.chunks), s.path)
+	return nil
+}
+
+// Reset removes every chunk from the store and restarts ID allocation.
+func (s *VectorStore) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chunks = make([]DocumentChunk, 0)
+	s.files = make(map[string]FileRecord)
+	s.nextDocumentID = 1
+	s.reindexLocked()
+	if s.index != nil {
+		s.index = newHNSWIndex(s.indexOptions)
+	}
+	s.dirty, s.indexDirty = true, true
+}
+
+// indexPath returns the location of the persisted vector index, or "" for a
+// memory-only store.
+func (s *VectorStore) indexPath() string {
+	if s.path == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(s.path), vectorIndexFileName)
+}
+
+// ConfigureIndex switches between HNSW and exact search and applies the HNSW
+// parameters. The graph saved next to the store is reused if it was built with the
+// same parameters; otherwise it is rebuilt, which can take a while for large stores.
+func (s *VectorStore) ConfigureIndex(options VectorIndexOptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.indexOptions
+	s.indexOptions = options
+	if options.Type == vectorIndexExact {
+		if s.index != nil {
+			log.Println("Vector index disabled; searching every chunk exactly.")
+		}
+		s.index = nil
+		s.indexDirty = true // Removes the saved graph
+		return
+	}
+	if s.index != nil && previous.M == options.M && previous.EfConstruction == options.EfConstruction {
+		s.index.efSearch = options.EfSearch
+		s.index.setQuantize(options.Quantization == quantizationInt8)
+		return
+	}
+
+	if s.index == nil && s.indexPath() != "" {
+		index, err := loadHNSWIndex(s.indexPath(), options, s.embeddingModel, s.chunks)
+		if err == nil {
+			s.index = index
+			log.Printf("Loaded vector index with %d nodes from %s.", len(index.nodes), s.indexPath())
+			return
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Rebuilding vector index: %v", err)
+		}
+	}
+	start := time.Now()
+	s.index = buildHNSWIndex(options, s.chunks)
+	s.indexDirty = true
+	log.Printf("Built vector index over %d chunks in %v (M=%d, efConstruction=%d).", len(s.index.nodes), time.Since(start), options.M, options.EfConstruction)
+}
+
+// EmbeddingModel returns the model the stored embeddings were computed with.
+func (s *VectorStore) EmbeddingModel() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.embeddingModel
+}
+
+// SetEmbeddingModel records the model the stored embeddings are computed with.
+func (s *VectorStore) SetEmbeddingModel(model string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if model != s.embeddingModel {
+		s.embeddingModel = model
+		s.dirty, s.indexDirty = true, true // The graph file records the model too
+	}
+}
+
+// FileRecord returns the record of an indexed source file, if any.
+func (s *VectorStore) FileRecord(sourceFile string) (FileRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.files[sourceFile]
+	return record, ok
+}
+
+// SourceFiles returns the names of every source file that has a record or chunks in the store.
+func (s *VectorStore) SourceFiles() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	seen := make(map[string]bool, len(s.files))
+	for name := range s.files {
+		seen[name] = true
+	}
+	for _, chunk := range s.chunks {
+		seen[chunk.SourceFile] = true
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetFileRecord updates the record of a source file without touching its chunks.
+func (s *VectorStore) SetFileRecord(record FileRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[record.SourceFile] = record
+	s.dirty = true
+}
+
+// RefreshFileMetadata derives the metadata of an unchanged source file's chunks again
+// from its path and record, so edited tag rules and patient folder settings apply
+// without re-embedding the file.
+func (s *VectorStore) RefreshFileMetadata(sourceFile string, options LoadOptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := s.fileChunks[sourceFile]
+	if len(ids) == 0 {
+		return
+	}
+	record := s.files[sourceFile]
+	meta := chunkMetadataFor(sourceFile, record.Metadata, record.Header, options)
+	for _, id := range ids {
+		chunk := &s.chunks[s.positions[id]]
+		if !reflect.DeepEqual(chunk.Metadata, meta) {
+			chunk.Metadata = meta
+			s.dirty = true
+		}
+	}
+}
+
+// ReplaceFile swaps all chunks of record.SourceFile for the given ones, assigning
+// fresh document IDs and the source file, and stores the record.
+func (s *VectorStore) ReplaceFile(record FileRecord, chunks []DocumentChunk) []DocumentChunk {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeFileLocked(record.SourceFile)
+
+	added := make([]DocumentChunk, 0, len(chunks))
+	for _, chunk := range chunks {
+		chunk.ID = s.nextDocumentID
+		chunk.SourceFile = record.SourceFile
+		s.positions[chunk.ID] = len(s.chunks)
+		s.fileChunks[chunk.SourceFile] = append(s.fileChunks[chunk.SourceFile], chunk.ID)
+		s.chunks = append(s.chunks, chunk)
+		s.keywords.add(chunk)
+		if s.index != nil {
+			s.index.insert(chunk.ID, chunk.Embedding)
+		}
+		s.nextDocumentID++
+		added = append(added, chunk)
+	}
+	s.files[record.SourceFile] = record
+	s.dirty = true
+	if s.index != nil && len(added) > 0 {
+		s.indexDirty = true
+	}
+	return added
+}
+
+// RemoveFile drops every chunk and the record belonging to sourceFile.
+// It returns the number of chunks removed.
+func (s *VectorStore) RemoveFile(sourceFile string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.removeFileLocked(sourceFile)
+}
+
+// removeFileLocked is RemoveFile for callers already holding s.mu.
+func (s *VectorStore) removeFileLocked(sourceFile string) int {
+	kept := s.chunks[:0]
+	var removed []DocumentChunk
+	for _, chunk := range s.chunks {
+		if chunk.SourceFile == sourceFile {
+			removed = append(removed, chunk)
+			continue
+		}
+		kept = append(kept, chunk)
+	}
+	s.chunks = kept
+	if _, ok := s.files[sourceFile]; ok || len(removed) > 0 {
+		delete(s.files, sourceFile)
+		s.dirty = true
+	}
+	if len(removed) > 0 {
+		s.keywords.remove(removed)
+		s.updatePositionsLocked()
+		if s.index != nil {
+			ids := make([]int, len(removed))
+			for i, chunk := range removed {
+				ids[i] = chunk.ID
+			}
+			s.index.remove(ids)
+			s.indexDirty = true
+		}
+	}
+	return len(removed)
+}
+
+// Len returns the number of chunks in the store.
+func (s *VectorStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.chunks)
+}
+
+// FindRelevantChunks finds the top N most similar document chunks to a query embedding.
+func (s *VectorStore) FindRelevantChunks(queryEmbedding []float32, topN int) []DocumentChunk {
+	return s.Search(queryEmbedding, "", RetrievalOptions{Mode: retrievalVector, TopN: topN}, chunkFilter{})
+}
+
+// Search finds the top N chunks for a question, best first, with the retrieval mode of
+// options: by embedding similarity to queryEmbedding, by BM25 keyword match on query,
+// or both fused. queryEmbedding is not used in keyword mode and may be nil. Only chunks
+// whose metadata passes filter are considered.
+func (s *VectorStore) Search(queryEmbedding []float32, query string, options RetrievalOptions, filter chunkFilter) []DocumentChunk {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.chunks) == 0 {
+		log.Println("Document store is empty. Cannot find relevant chunks.")
+		return []DocumentChunk{}
+	}
+	topN := options.TopN
+	if topN <= 0 {
+		topN = 3 // Default to top 3 if not specified or invalid
+	}
+
+	var resultChunks []DocumentChunk
+	switch options.Mode {
+	case retrievalKeyword:
+		resultChunks = s.keywordChunksLocked(query, topN, filter)
+	case retrievalHybrid:
+		// Each retriever proposes more candidates than needed, so a chunk ranked low by
+		// one but high by the other can still make it into the fused top N.
+		candidates := topN * hybridCandidateFactor
+		vector := s.vectorChunksLocked(queryEmbedding, candidates, filter)
+		keyword := s.keywordChunksLocked(query, candidates, filter)
+		s.fillVectorScoresLocked(queryEmbedding, keyword)
+		resultChunks = fuseRankings(vector, keyword, options, topN)
+	default:
+		resultChunks = s.vectorChunksLocked(queryEmbedding, topN, filter)
+	}
+
+	for i, chunk := range resultChunks {
+		log.Printf("Selected relevant chunk %d: ID %d, Source: %s, Score: %.4f", i+1, chunk.ID, chunk.SourceFile, chunk.Score)
+	}
+	return resultChunks
+}
+
+// vectorChunksLocked returns the topN chunks passing filter that are most similar to
+// queryEmbedding, with Score and VectorScore set to the cosine similarity. It uses the
+// HNSW index if there is one and no filter is set; a filter usually leaves few enough
+// chunks to compare with each, and the graph's nearest neighbours might all fail it.
+// The caller must hold s.mu.
+func (s *VectorStore) vectorChunksLocked(queryEmbedding []float32, topN int, filter chunkFilter) []DocumentChunk {
+	if s.index == nil || !filter.empty() {
+		return s.exactVectorChunksLocked(queryEmbedding, topN, filter)
+	}
+	nearest := s.index.search(queryEmbedding, topN)
+	resultChunks := make([]DocumentChunk, 0, len(nearest))
+	for _, candidate := range nearest {
+		chunk := s.chunks[s.positions[candidate.id]]
+		chunk.Score = 1 - candidate.dist
+		chunk.VectorScore = chunk.Score
+		resultChunks = append(resultChunks, chunk)
+	}
+	return resultChunks
+}
+
+// exactVectorChunksLocked is vectorChunksLocked comparing the query with every chunk.
+func (s *VectorStore) exactVectorChunksLocked(queryEmbedding []float32, topN int, filter chunkFilter) []DocumentChunk {
+	var rankedChunks []rankedChunk
+
+	for _, chunk := range s.chunks {
+		if !filter.matches(chunk.Metadata) {
+			continue
+		}
+		if len(chunk.Embedding) == 0 {
+			log.Printf("Skipping chunk ID %d from %s due to empty embedding.", chunk.ID, chunk.SourceFile)
+			continue
+		}
+		similarity, err := cosineSimilarity(queryEmbedding, chunk.Embedding)
+		if err != nil {
+			log.Printf("Error calculating similarity for chunk ID %d (%s): %v. Skipping.", chunk.ID, chunk.SourceFile, err)
+			continue
+		}
+		rankedChunks = append(rankedChunks, rankedChunk{chunk: chunk, score: similarity})
+	}
+
+	// Sort chunks by score in descending order
+	sort.Slice(rankedChunks, func(i, j int) bool {
+		return rankedChunks[i].score > rankedChunks[j].score
+	})
+
+	numToReturn := min(topN, len(rankedChunks))
+	resultChunks := make([]DocumentChunk, numToReturn)
+	for i := 0; i < numToReturn; i++ {
+		// Assign the chunk and its calculated score to the result
+		chunkWithScore := rankedChunks[i].chunk
+		chunkWithScore.Score = rankedChunks[i].score // Explicitly set the score
+		chunkWithScore.VectorScore = rankedChunks[i].score
+		resultChunks[i] = chunkWithScore
+	}
+
+	return resultChunks
+}
+
+// keywordChunksLocked returns the topN chunks passing filter with the best BM25 match
+// for query, with Score and KeywordScore set to the normalised BM25 score. The caller
+// must hold s.mu.
+func (s *VectorStore) keywordChunksLocked(query string, topN int, filter chunkFilter) []DocumentChunk {
+	var accept func(chunkID int) bool
+	if !filter.empty() {
+		accept = func(chunkID int) bool { return filter.matches(s.chunks[s.positions[chunkID]].Metadata) }
+	}
+	matches := s.keywords.search(query, topN, accept)
+	resultChunks := make([]DocumentChunk, 0, len(matches))
+	for _, match := range matches {
+		chunk := s.chunks[s.positions[match.chunkID]]
+		chunk.Score = match.score
+		chunk.KeywordScore = match.score
+		resultChunks = append(resultChunks, chunk)
+	}
+	return resultChunks
+}
+
+// fillVectorScoresLocked sets VectorScore on chunks found by keyword search, so they
+// can be weighed against the chunks found by similarity. The caller must hold s.mu.
+func (s *VectorStore) fillVectorScoresLocked(queryEmbedding []float32, chunks []DocumentChunk) {
+	for i := range chunks {
+		if len(chunks[i].Embedding) == 0 {
+			continue
+		}
+		if similarity, err := cosineSimilarity(queryEmbedding, chunks[i].Embedding); err == nil {
+			chunks[i].VectorScore = similarity
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeStoreFile writes raw store data to a vector store file in a temporary folder
+// and returns its path.
+func writeStoreFile(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), vectorStoreFileName)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// storedSchemaVersion returns the schema version of the store file at path.
+func storedSchemaVersion(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	return file.SchemaVersion
+}
+
+func TestMigrateNormalisesEmbeddings(t *testing.T) {
+	path := writeStoreFile(t, `{"schema_version": 2, "next_document_id": 3, "files": {}, "chunks": [
+		{"id": 1, "text": "a", "source_file": "a.txt", "embedding": [3, 4]},
+		{"id": 2, "text": "b", "source_file": "b.txt"}
+	]}`)
+
+	store, err := openVectorStore(path)
+	if err != nil {
+		t.Fatalf("openVectorStore() error = %v", err)
+	}
+	if got := store.chunks[0].Embedding; len(got) != 2 || math.Abs(float64(got[0])-0.6) > 1e-6 || math.Abs(float64(got[1])-0.8) > 1e-6 {
+		t.Errorf("embedding = %v, want [0.6 0.8]", got)
+	}
+	if got := store.chunks[1].Embedding; got != nil {
+		t.Errorf("missing embedding became %v", got)
+	}
+	if got := storedSchemaVersion(t, path); got != vectorStoreSchemaVersion {
+		t.Errorf("stored schema version = %d after loading, want the migrated store saved as %d", got, vectorStoreSchemaVersion)
+	}
+}
+
+func TestOpenCurrentStoreDoesNotRewrite(t *testing.T) {
+	store := newMemoryVectorStore()
+	store.path = filepath.Join(t.TempDir(), vectorStoreFileName)
+	store.ReplaceFile(FileRecord{SourceFile: "a.txt"}, []DocumentChunk{{Text: "a", Embedding: []float32{1, 0}}})
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(store.path, before.ModTime().Add(-time.Hour), before.ModTime().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := openVectorStore(store.path); err != nil {
+		t.Fatalf("openVectorStore() error = %v", err)
+	}
+	after, err := os.Stat(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.ModTime().Equal(before.ModTime().Add(-time.Hour)) {
+		t.Error("a store at the current schema version was rewritten on load")
+	}
+}
+
+func TestMigrateDerivesMetadata(t *testing.T) {
+	path := writeStoreFile(t, `{"schema_version": 3, "next_document_id": 4, "chunks": [
+		{"id": 1, "text": "Patient ID: 1234. Echocardiogram of 05/02/2023.", "source_file": "1234/2023/echo.txt"},
+		{"id": 2, "text": "LVEF 55%.", "source_file": "1234/2023/echo.txt"},
+		{"id": 3, "text": "Hemoglobin 13.5 g/dL", "source_file": "labs/blood.txt"}
+	], "files": {"labs/blood.txt": {"source_file": "labs/blood.txt", "metadata": {"date": "2022-11-30T08:00:00Z"}}}}`)
+
+	store, err := openVectorStore(path)
+	if err != nil {
+		t.Fatalf("openVectorStore() error = %v", err)
+	}
+	echo := ChunkMetadata{Path: "1234/2023/echo.txt", DocType: "cardiology", Date: "2023-02-05", PatientID: "1234"}
+	want := []ChunkMetadata{echo, echo, {Path: "labs/blood.txt", DocType: "lab", Date: "2022-11-30"}}
+	for i, chunk := range store.chunks {
+		if got := chunk.Metadata; got.Path != want[i].Path || got.DocType != want[i].DocType || got.Date != want[i].Date || got.PatientID != want[i].PatientID {
+			t.Errorf("chunk %d metadata = %+v, want %+v", chunk.ID, got, want[i])
+		}
+	}
+	if got := storedSchemaVersion(t, path); got != vectorStoreSchemaVersion {
+		t.Errorf("stored schema version = %d, want %d", got, vectorStoreSchemaVersion)
+	}
+}
+
+func TestMigrateRebuildsHeader(t *testing.T) {
+	path := writeStoreFile(t, `{"schema_version": 4, "next_document_id": 4, "chunks": [
+		{"id": 2, "text": "Seen on 05/02/2023.", "source_file": "echo.txt", "metadata": {"path": "echo.txt"}},
+		{"id": 1, "text": "Patient ID: 1234. Echocardiogram.", "source_file": "echo.txt", "metadata": {"path": "echo.txt"}},
+		{"id": 3, "text": "Hemoglobin 13.5 g/dL", "source_file": "orphan.txt", "metadata": {"path": "orphan.txt"}}
+	], "files": {"echo.txt": {"source_file": "echo.txt"}}}`)
+
+	store, err := openVectorStore(path)
+	if err != nil {
+		t.Fatalf("openVectorStore() error = %v", err)
+	}
+	want := HeaderMetadata{PatientID: "1234", Date: "2023-02-05"}
+	if got := store.files["echo.txt"].Header; got != want {
+		t.Errorf("header of echo.txt = %+v, want %+v", got, want)
+	}
+	if _, ok := store.files["orphan.txt"]; ok {
+		t.Error("migration added a record for a file that had none")
+	}
+	store.RefreshFileMetadata("echo.txt", LoadOptions{})
+	for _, chunk := range store.chunks {
+		if chunk.SourceFile == "echo.txt" && (chunk.Metadata.PatientID != want.PatientID || chunk.Metadata.Date != want.Date) {
+			t.Errorf("chunk %d metadata after refreshing = %+v, want the header's patient and date", chunk.ID, chunk.Metadata)
+		}
+	}
+}
+
+func TestRefreshFileMetadata(t *testing.T) {
+	store := newMemoryVectorStore()
+	store.ReplaceFile(FileRecord{SourceFile: "5678/2024/visit1/notes.txt"}, []DocumentChunk{{Text: "Follow-up visit."}, {Text: "Stable."}})
+	store.ReplaceFile(FileRecord{SourceFile: "9999/2024/visit1/notes.txt"}, []DocumentChunk{{Text: "Other patient."}})
+
+	options := LoadOptions{PatientPathSegment: 1, TagRules: []TagRule{{Pattern: "*/2024/**", Tags: []string{"Current"}}}}
+	store.RefreshFileMetadata("5678/2024/visit1/notes.txt", options)
+	for _, chunk := range store.chunks {
+		meta := chunk.Metadata
+		if chunk.SourceFile != "5678/2024/visit1/notes.txt" {
+			if meta.PatientID != "" {
+				t.Errorf("chunk %d of another file was refreshed: %+v", chunk.ID, meta)
+			}
+			continue
+		}
+		if meta.PatientID != "5678" || len(meta.Tags) != 1 || meta.Tags[0] != "current" {
+			t.Errorf("chunk %d metadata = %+v, want patient 5678 tagged current", chunk.ID, meta)
+		}
+	}
+}
+
+// backdate sets the modification time of path an hour back, so a later write shows.
+func backdate(t *testing.T, path string) {
+	t.Helper()
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// rewritten reports whether path was written since it was backdated.
+func rewritten(t *testing.T, path string) bool {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return time.Since(info.ModTime()) < 30*time.Minute
+}
+
+func TestSaveWritesOnlyChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), vectorStoreFileName)
+	store, err := openVectorStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.ConfigureIndex(defaultVectorIndexOptions())
+	store.ReplaceFile(FileRecord{SourceFile: "a.txt"}, []DocumentChunk{{Text: "a", Embedding: []float32{1, 0}, Metadata: ChunkMetadata{Path: "a.txt"}}})
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	indexPath := store.indexPath()
+
+	tests := []struct {
+		name       string
+		change     func(s *VectorStore)
+		wantStore  bool
+		wantIndex  bool
+		reopenFrom bool // Open the saved files again before the change
+	}{
+		{"nothing", func(s *VectorStore) {}, false, false, false},
+		{"reopened", func(s *VectorStore) {}, false, false, true},
+		{"same metadata", func(s *VectorStore) { s.RefreshFileMetadata("a.txt", LoadOptions{}) }, false, false, false},
+		{"same embedding model", func(s *VectorStore) { s.SetEmbeddingModel(s.EmbeddingModel()) }, false, false, false},
+		{"removing a missing file", func(s *VectorStore) { s.RemoveFile("missing.txt") }, false, false, false},
+		{"new tags", func(s *VectorStore) {
+			s.RefreshFileMetadata("a.txt", LoadOptions{TagRules: []TagRule{{Pattern: "*.txt", Tags: []string{"notes"}}}})
+		}, true, false, false},
+		{"file record", func(s *VectorStore) { s.SetFileRecord(FileRecord{SourceFile: "a.txt", Size: 1}) }, true, false, false},
+		{"new file", func(s *VectorStore) {
+			s.ReplaceFile(FileRecord{SourceFile: "b.txt"}, []DocumentChunk{{Text: "b", Embedding: []float32{0, 1}}})
+		}, true, true, false},
+		{"removed file", func(s *VectorStore) { s.RemoveFile("b.txt") }, true, true, false},
+		{"embedding model", func(s *VectorStore) { s.SetEmbeddingModel("other-model") }, true, true, false},
+		{"index disabled", func(s *VectorStore) {
+			options := defaultVectorIndexOptions()
+			options.Type = vectorIndexExact
+			s.ConfigureIndex(options)
+		}, false, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.reopenFrom {
+				if store, err = openVectorStore(path); err != nil {
+					t.Fatal(err)
+				}
+				store.ConfigureIndex(defaultVectorIndexOptions())
+			}
+			backdate(t, path)
+			if _, err := os.Stat(indexPath); err == nil {
+				backdate(t, indexPath)
+			}
+			tt.change(store)
+			if err := store.Save(); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			if got := rewritten(t, path); got != tt.wantStore {
+				t.Errorf("store file rewritten = %t, want %t", got, tt.wantStore)
+			}
+			_, err := os.Stat(indexPath)
+			if gotIndex := err != nil || rewritten(t, indexPath); gotIndex != tt.wantIndex {
+				t.Errorf("index file rewritten or removed = %t, want %t", gotIndex, tt.wantIndex)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+)
+
+const int8RescoreFactor = 4 // An int8 scan keeps this many times k candidates for float32 rescoring
+
+// unitEmbedding converts an embedding returned by Ollama to float32, the precision the
+// models produce, and scales it to unit length so cosine similarity is a dot product.
+// It returns nil for an empty or zero vector.
+func unitEmbedding(v []float64) []float32 {
+	norm := 0.0
+	for _, x := range v {
+		norm += x * x
+	}
+	if norm == 0 {
+		return nil
+	}
+	norm = math.Sqrt(norm)
+	unit := make([]float32, len(v))
+	for i, x := range v {
+		unit[i] = float32(x / norm)
+	}
+	return unit
+}
+
+// dotProduct returns the dot product of two vectors of the same length.
+func dotProduct(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// int8Vector is a unit vector quantized to one signed byte per dimension. Each
+// component is codes[i] * scale, where scale maps the largest component to 127.
+type int8Vector struct {
+	codes []int8
+	scale float32
+}
+
+// quantizeInt8 quantizes a vector; a zero vector gives empty codes.
+func quantizeInt8(v []float32) int8Vector {
+	var maxAbs float32
+	for _, x := range v {
+		maxAbs = max(maxAbs, x, -x)
+	}
+	if maxAbs == 0 {
+		return int8Vector{}
+	}
+	q := int8Vector{codes: make([]int8, len(v)), scale: maxAbs / 127}
+	for i, x := range v {
+		q.codes[i] = int8(math.Round(float64(x / q.scale)))
+	}
+	return q
+}
+
+// dot approximates the dot product of the vectors q and o were quantized from.
+func (q int8Vector) dot(o int8Vector) float32 {
+	if len(q.codes) != len(o.codes) {
+		return 0 // A zero vector has no codes
+	}
+	var sum int32
+	for i := range q.codes {
+		sum += int32(q.codes[i]) * int32(o.codes[i])
+	}
+	return float32(sum) * q.scale * o.scale
+}
+
+// EmbeddingBenchmark compares the memory use, recall and speed of the embedding
+// representations over the loaded chunks. Recall is the share of the exact float32
+// top K that a representation finds. The float32 vectors are always kept, so int8
+// codes add Int8Bytes to Float32Bytes.
+type EmbeddingBenchmark struct {
+	Chunks        int     `json:"chunks"`
+	Dimensions    int     `json:"dimensions"`
+	Queries       int     `json:"queries"` // Stored embeddings used as test queries
+	K             int     `json:"k"`
+	Float64Bytes  int64   `json:"float64Bytes"`  // Memory the vectors took as []float64
+	Float32Bytes  int64   `json:"float32Bytes"`  // Memory they take as []float32
+	Int8Bytes     int64   `json:"int8Bytes"`     // Memory the int8 codes and scales take on top of the float32 vectors
+	Float32Micros float64 `json:"float32Micros"` // Average time of an exact float32 scan per query
+	Int8Micros    float64 `json:"int8Micros"`    // Average time of an int8 scan with rescoring per query
+	// Float32Recall compares float32 with float64 arithmetic over the same vectors,
+	// showing what the lower precision costs in ranking.
+	Float32Recall     float64 `json:"float32Recall"`
+	Int8Recall        float64 `json:"int8Recall"`        // Ranking by int8 codes alone
+	Int8RescoreRecall float64 `json:"int8RescoreRecall"` // int8 candidates rescored with float32
+}
+
+// scoredID is a chunk position with a similarity score, for benchmark rankings.
+type scoredID struct {
+	pos   int
+	score float64
+}
+
+// topScores returns the positions of the k best scores, best first.
+func topScores(n, k int, score func(pos int) float64) []scoredID {
+	scored := make([]scoredID, 0, n)
+	for pos := 0; pos < n; pos++ {
+		scored = append(scored, scoredID{pos: pos, score: score(pos)})
+	}
+	sort.Slice(scored, func(i, j int) bool { return scored[i].score > scored[j].score })
+	return scored[:min(k, len(scored))]
+}
+
+// overlap counts the positions of want that are also in got.
+func overlap(want, got []scoredID) int {
+	found := make(map[int]bool, len(got))
+	for _, s := range got {
+		found[s.pos] = true
+	}
+	count := 0
+	for _, s := range want {
+		if found[s.pos] {
+			count++
+		}
+	}
+	return count
+}
+
+// BenchmarkEmbeddings measures, over the stored chunks, how float32 and int8 vectors
+// compare with exact float32 search, using the embeddings of up to queries evenly
+// spread chunks as queries.
+func (s *VectorStore) BenchmarkEmbeddings(queries, k int) (EmbeddingBenchmark, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var vectors [][]float32
+	for _, chunk := range s.chunks {
+		if len(chunk.Embedding) > 0 {
+			vectors = append(vectors, chunk.Embedding)
+		}
+	}
+	if len(vectors) == 0 {
+		return EmbeddingBenchmark{}, errors.New("no chunk has an embedding; load documents first")
+	}
+	dims := len(vectors[0])
+	for _, v := range vectors {
+		if len(v) != dims {
+			return EmbeddingBenchmark{}, errors.New("stored embeddings have different lengths; load documents again")
+		}
+	}
+
+	bench := EmbeddingBenchmark{Chunks: len(vectors), Dimensions: dims, K: k}
+	quantized := make([]int8Vector, len(vectors))
+	for i, v := range vectors {
+		quantized[i] = quantizeInt8(v)
+	}
+	bench.Float64Bytes = int64(len(vectors)) * int64(dims) * 8
+	bench.Float32Bytes = int64(len(vectors)) * int64(dims) * 4
+	bench.Int8Bytes = int64(len(vectors)) * (int64(dims) + 4)
+
+	var float32Time, int8Time time.Duration
+	var float32Found, int8Found, rescoreFound, expected int
+	step := max(1, len(vectors)/queries)
+	for i := 0; i < len(vectors) && bench.Queries < queries; i += step {
+		bench.Queries++
+		query, quantizedQuery := vectors[i], quantized[i]
+
+		start := time.Now()
+		exact := topScores(len(vectors), k, func(pos int) float64 { return float64(dotProduct(query, vectors[pos])) })
+		float32Time += time.Since(start)
+
+		start = time.Now()
+		candidates := topScores(len(vectors), k*int8RescoreFactor, func(pos int) float64 { return float64(quantizedQuery.dot(quantized[pos])) })
+		rescored := make([]scoredID, len(candidates))
+		for j, candidate := range candidates {
+			rescored[j] = scoredID{pos: candidate.pos, score: float64(dotProduct(query, vectors[candidate.pos]))}
+		}
+		sort.Slice(rescored, func(a, b int) bool { return rescored[a].score > rescored[b].score })
+		int8Time += time.Since(start)
+
+		float64Ranking := topScores(len(vectors), k, func(pos int) float64 {
+			sum := 0.0
+			for d, x := range query {
+				sum += float64(x) * float64(vectors[pos][d])
+			}
+			return sum
+		})
+
+		expected += len(exact)
+		float32Found += overlap(float64Ranking, exact)
+		int8Found += overlap(exact, candidates[:min(k, len(candidates))])
+		rescoreFound += overlap(exact, rescored[:min(k, len(rescored))])
+	}
+
+	bench.Float32Recall = float64(float32Found) / float64(expected)
+	bench.Int8Recall = float64(int8Found) / float64(expected)
+	bench.Int8RescoreRecall = float64(rescoreFound) / float64(expected)
+	bench.Float32Micros = float64(float32Time.Microseconds()) / float64(bench.Queries)
+	bench.Int8Micros = float64(int8Time.Microseconds()) / float64(bench.Queries)
+	return bench, nil
+}
+
+// BenchmarkEmbeddings is a Wails-bindable method that reports, over the loaded
+// documents, what int8 codes cost in memory and recall and how much faster they scan,
+// to decide whether int8 quantization of the HNSW graph is worth enabling. The
+// distance kernels themselves are measured by the benchmarks in vectors_test.go.
+func (a *App) BenchmarkEmbeddings(queries int) (EmbeddingBenchmark, error) {
+	if queries < 1 {
+		queries = 100
+	}
+	bench, err := a.store.BenchmarkEmbeddings(queries, a.currentSettings().Retrieval.TopN)
+	if err != nil {
+		return bench, fmt.Errorf("could not benchmark embeddings: %w", err)
+	}
+	log.Printf("Embedding benchmark over %d chunks: float32 %d bytes (recall %.3f, %.0fµs), int8 codes %d more bytes (recall %.3f, rescored %.3f, %.0fµs); float64 took %d bytes.",
+		bench.Chunks, bench.Float32Bytes, bench.Float32Recall, bench.Float32Micros, bench.Int8Bytes, bench.Int8Recall, bench.Int8RescoreRecall, bench.Int8Micros, bench.Float64Bytes)
+	return bench, nil
+}
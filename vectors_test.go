@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// randomUnitVectors returns n random unit vectors of the given length.
+func randomUnitVectors(rng *rand.Rand, n, dims int) [][]float32 {
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		v := make([]float64, dims)
+		for d := range v {
+			v[d] = rng.NormFloat64()
+		}
+		vectors[i] = unitEmbedding(v)
+	}
+	return vectors
+}
+
+func TestUnitEmbedding(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []float64
+		want []float32
+	}{
+		{"scaled", []float64{3, 4}, []float32{0.6, 0.8}},
+		{"already unit", []float64{0, 1}, []float32{0, 1}},
+		{"zero", []float64{0, 0}, nil},
+		{"empty", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unitEmbedding(tt.in)
+			if len(got) != len(tt.want) {
+				t.Fatalf("unitEmbedding(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+			for i := range got {
+				if math.Abs(float64(got[i]-tt.want[i])) > 1e-6 {
+					t.Fatalf("unitEmbedding(%v) = %v, want %v", tt.in, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestInt8DotApproximatesFloat32(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	vectors := randomUnitVectors(rng, 50, 384)
+	for i := 1; i < len(vectors); i++ {
+		exact := dotProduct(vectors[0], vectors[i])
+		approx := quantizeInt8(vectors[0]).dot(quantizeInt8(vectors[i]))
+		if math.Abs(float64(exact-approx)) > 0.01 {
+			t.Errorf("int8 dot %v too far from float32 dot %v", approx, exact)
+		}
+	}
+	if got := quantizeInt8(vectors[0]).dot(quantizeInt8(make([]float32, 384))); got != 0 {
+		t.Errorf("dot with a zero vector = %v, want 0", got)
+	}
+}
+
+// benchmarkVectors returns a query and a corpus of the size and embedding length
+// typical for nomic-embed-text over a few thousand document chunks.
+func benchmarkVectors() ([]float32, [][]float32) {
+	vectors := randomUnitVectors(rand.New(rand.NewSource(1)), 5001, 768)
+	return vectors[0], vectors[1:]
+}
+
+func BenchmarkDotFloat32(b *testing.B) {
+	query, vectors := benchmarkVectors()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dotProduct(query, vectors[i%len(vectors)])
+	}
+}
+
+func BenchmarkDotInt8(b *testing.B) {
+	query, vectors := benchmarkVectors()
+	q := quantizeInt8(query)
+	quantized := make([]int8Vector, len(vectors))
+	for i, v := range vectors {
+		quantized[i] = quantizeInt8(v)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q.dot(quantized[i%len(quantized)])
+	}
+}
+
+func BenchmarkScanFloat32(b *testing.B) {
+	query, vectors := benchmarkVectors()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		topScores(len(vectors), 10, func(pos int) float64 { return float64(dotProduct(query, vectors[pos])) })
+	}
+}
+
+func BenchmarkScanInt8Rescored(b *testing.B) {
+	query, vectors := benchmarkVectors()
+	q := quantizeInt8(query)
+	quantized := make([]int8Vector, len(vectors))
+	for i, v := range vectors {
+		quantized[i] = quantizeInt8(v)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		candidates := topScores(len(vectors), 10*int8RescoreFactor, func(pos int) float64 { return float64(q.dot(quantized[pos])) })
+		for j := range candidates {
+			candidates[j].score = float64(dotProduct(query, vectors[candidates[j].pos]))
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// defaultExcludePatterns skips temp files, Office lock files and hidden files/folders.
+// The default include patterns come from the extractor registry; see
+// supportedIncludePatterns.
+var defaultExcludePatterns = []string{"*.tmp", "~$*", ".*"}
+
+// LoadOptions controls which files LoadPersonalData picks up from the selected directory.
+// Patterns are matched against the slash-separated path relative to that directory.
+// A pattern without a slash matches the base name at any depth (e.g. "*.tmp"),
+// and "**" matches any number of path segments (e.g. "archive/**").
+type LoadOptions struct {
+	IncludePatterns  []string  `json:"includePatterns"`  // A file must match at least one of these
+	ExcludePatterns  []string  `json:"excludePatterns"`  // Matching files and folders are skipped
+	FollowSymlinks   bool      `json:"followSymlinks"`   // Descend into symlinked folders (loops are detected)
+	EmbedBatchSize   int       `json:"embedBatchSize"`   // Chunks sent per embedding request
+	EmbedConcurrency int       `json:"embedConcurrency"` // Embedding requests in flight at once
+	TagRules         []TagRule `json:"tagRules"`         // Custom tags for the files matching each pattern, for filtering retrieval
+	// PatientPathSegment is the folder level naming the patient, 1 for the top folder
+	// as in "<patient>/<year>/<visit>/*.txt". 0 looks for names such as "patient_1234".
+	PatientPathSegment int `json:"patientPathSegment"`
+}
+
+// defaultLoadOptions returns the loader configuration used until the user changes it.
+func defaultLoadOptions() LoadOptions {
+	return LoadOptions{
+		IncludePatterns:  supportedIncludePatterns(),
+		ExcludePatterns:  append([]string(nil), defaultExcludePatterns...),
+		FollowSymlinks:   true,
+		EmbedBatchSize:   defaultEmbedBatchSize,
+		EmbedConcurrency: defaultEmbedConcurrency,
+	}
+}
+
+// validate checks that every pattern is a well-formed glob and that the embedding
+// settings are in range.
+func (o LoadOptions) validate() error {
+	if o.EmbedBatchSize < 1 || o.EmbedBatchSize > maxEmbedBatchSize {
+		return fmt.Errorf("embed batch size must be between 1 and %d", maxEmbedBatchSize)
+	}
+	if o.EmbedConcurrency < 1 || o.EmbedConcurrency > maxEmbedConcurrency {
+		return fmt.Errorf("embed concurrency must be between 1 and %d", maxEmbedConcurrency)
+	}
+	if o.PatientPathSegment < 0 {
+		return fmt.Errorf("patient path segment must not be negative")
+	}
+	if len(o.IncludePatterns) == 0 {
+		return fmt.Errorf("at least one include pattern is required")
+	}
+	patterns := append(append([]string(nil), o.IncludePatterns...), o.ExcludePatterns...)
+	for _, rule := range o.TagRules {
+		patterns = append(patterns, rule.Pattern)
+	}
+	for _, pattern := range patterns {
+		if strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("patterns must not be empty")
+		}
+		for _, segment := range strings.Split(pattern, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// GetLoadOptions is a Wails-bindable method returning the current loader configuration.
+func (a *App) GetLoadOptions() LoadOptions {
+	return a.currentSettings().Load
+}
+
+// SetLoadOptions is a Wails-bindable method that replaces the loader configuration
+// used by the next LoadPersonalData call. The options are saved with the settings.
+func (a *App) SetLoadOptions(options LoadOptions) error {
+	if err := a.updateSettings(func(s *Settings) { s.Load = options }); err != nil {
+		return err
+	}
+	log.Printf("Load options updated: include=%v exclude=%v followSymlinks=%t embedBatchSize=%d embedConcurrency=%d tagRules=%d patientPathSegment=%d",
+		options.IncludePatterns, options.ExcludePatterns, options.FollowSymlinks, options.EmbedBatchSize, options.EmbedConcurrency, len(options.TagRules), options.PatientPathSegment)
+	return nil
+}
+
+// matchGlob reports whether the slash-separated relative path matches pattern.
+// Patterns without a slash are matched against the base name only.
+func matchGlob(pattern, relPath string) bool {
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(relPath))
+		return matched
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(relPath, "/"))
+}
+
+// matchSegments matches path segments against pattern segments, where a "**"
+// segment matches zero or more path segments.
+func matchSegments(patternSegs, pathSegs []string) bool {
+	for len(patternSegs) > 0 {
+		if patternSegs[0] == "**" {
+			for skip := 0; skip <= len(pathSegs); skip++ {
+				if matchSegments(patternSegs[1:], pathSegs[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(pathSegs) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(patternSegs[0], pathSegs[0]); !matched {
+			return false
+		}
+		patternSegs = patternSegs[1:]
+		pathSegs = pathSegs[1:]
+	}
+	return len(pathSegs) == 0
+}
+
+// matchAny reports whether relPath matches at least one of patterns.
+// Matching is case-insensitive, so "*.txt" also picks up "REPORT.TXT".
+func matchAny(patterns []string, relPath string) bool {
+	relPath = strings.ToLower(relPath)
+	for _, pattern := range patterns {
+		if matchGlob(strings.ToLower(pattern), relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// documentFile is a file found by walkDocuments.
+type documentFile struct {
+	Path    string      // Absolute (or root-joined) path used to read the file
+	RelPath string      // Slash-separated path relative to the walk root, used as SourceFile
+	Info    os.FileInfo // Info of the file itself (symlinks resolved)
+}
+
+// walkDocuments recursively collects the files under root selected by options.
+// Symlinked folders are followed when options.FollowSymlinks is set; every folder is
+// visited at most once based on its resolved path, so symlink loops terminate.
+func walkDocuments(root string, options LoadOptions) ([]documentFile, error) {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve directory %s: %w", root, err)
+	}
+	visited := map[string]bool{realRoot: true}
+	var files []documentFile
+	if err := walkDocumentsDir(root, "", options, visited, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// walkDocumentsDir is the recursive step of walkDocuments for the folder at dirPath,
+// whose path relative to the walk root is relDir ("" for the root itself).
+func walkDocumentsDir(dirPath, relDir string, options LoadOptions, visited map[string]bool, files *[]documentFile) error {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		if relDir == "" {
+			return fmt.Errorf("error reading directory %s: %w", dirPath, err)
+		}
+		log.Printf("Error reading directory %s: %v. Skipping.", dirPath, err)
+		return nil
+	}
+
+	for _, entry := range entries {
+		entryPath := filepath.Join(dirPath, entry.Name())
+		relPath := path.Join(relDir, entry.Name())
+
+		if matchAny(options.ExcludePatterns, relPath) {
+			log.Printf("Excluded by pattern: %s", relPath)
+			continue
+		}
+
+		info, err := os.Lstat(entryPath)
+		if err != nil {
+			log.Printf("Error reading file info for %s: %v. Skipping.", entryPath, err)
+			continue
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if !options.FollowSymlinks {
+				log.Printf("Skipping symlink %s (following symlinks is disabled).", entryPath)
+				continue
+			}
+			info, err = os.Stat(entryPath)
+			if err != nil {
+				log.Printf("Error resolving symlink %s: %v. Skipping.", entryPath, err)
+				continue
+			}
+		}
+
+		if info.IsDir() {
+			realPath, err := filepath.EvalSymlinks(entryPath)
+			if err != nil {
+				log.Printf("Error resolving directory %s: %v. Skipping.", entryPath, err)
+				continue
+			}
+			if visited[realPath] {
+				log.Printf("Directory %s resolves to already visited %s (symlink loop?). Skipping.", entryPath, realPath)
+				continue
+			}
+			visited[realPath] = true
+			if err := walkDocumentsDir(entryPath, relPath, options, visited, files); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !info.Mode().IsRegular() || !matchAny(options.IncludePatterns, relPath) {
+			continue
+		}
+		*files = append(*files, documentFile{Path: entryPath, RelPath: relPath, Info: info})
+	}
+	return nil
+}
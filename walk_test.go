@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMatchSegments(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"**/notes.txt", "notes.txt", true},
+		{"**/notes.txt", "a/b/notes.txt", true},
+		{"**/notes.txt", "a/b/other.txt", false},
+		{"archive/**/scan.pdf", "archive/scan.pdf", true},
+		{"archive/**/scan.pdf", "archive/2021/03/scan.pdf", true},
+		{"archive/**/scan.pdf", "current/2021/scan.pdf", false},
+		{"archive/**", "archive", true},
+		{"archive/**", "archive/2021/scan.pdf", true},
+		{"archive/**", "archived/scan.pdf", false},
+		{"**", "a/b/c", true},
+		{"*/2024/**/*.txt", "1234/2024/visit1/notes.txt", true},
+		{"*/2024/**/*.txt", "1234/2023/visit1/notes.txt", false},
+		{"a/*/c", "a/b/c", true},
+		{"a/*/c", "a/b/x/c", false},
+		{"a/b", "a/b/c", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			if got := matchSegments(strings.Split(tt.pattern, "/"), strings.Split(tt.path, "/")); got != tt.want {
+				t.Errorf("matchSegments(%q, %q) = %t, want %t", tt.pattern, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchAny(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{"base name at any depth", []string{"*.txt"}, "a/b/notes.txt", true},
+		{"upper-case path", []string{"*.txt"}, "Scans/REPORT.TXT", true},
+		{"upper-case pattern", []string{"ARCHIVE/**"}, "archive/old.pdf", true},
+		{"mixed-case folders", []string{"**/Cardio/*.pdf"}, "patient/CARDIO/echo.PDF", true},
+		{"any of several", []string{"*.pdf", "*.docx"}, "letter.docx", true},
+		{"none", []string{"*.pdf", "*.docx"}, "letter.odt", false},
+		{"no patterns", nil, "letter.odt", false},
+		{"lock file", defaultExcludePatterns, "reports/~$letter.docx", true},
+		{"hidden folder", defaultExcludePatterns, ".git", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchAny(tt.patterns, tt.path); got != tt.want {
+				t.Errorf("matchAny(%q, %q) = %t, want %t", tt.patterns, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultIncludePatternsFollowExtractors(t *testing.T) {
+	got := defaultLoadOptions().IncludePatterns
+	for _, want := range []string{"*.docx", "*.odt", "*.pdf", "*.txt"} {
+		if !slices.Contains(got, want) {
+			t.Errorf("default include patterns %q lack %q", got, want)
+		}
+	}
+	if slices.Contains(got, "*") {
+		t.Errorf("default include patterns %q pick up every file", got)
+	}
+}
+
+func TestWalkDocuments(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"1234/2024/notes.txt", "1234/2024/scan.PDF", "1234/photo.jpg", "~$draft.docx", ".hidden/secret.txt"} {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte("text"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A loop back to the root and a second way into the same folder
+	if err := os.Symlink(root, filepath.Join(root, "1234", "2024", "loop")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "1234"), filepath.Join(root, "alias")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		followSymlinks bool
+		want           []string
+	}{
+		{"following symlinks", true, []string{"1234/2024/notes.txt", "1234/2024/scan.PDF"}},
+		{"ignoring symlinks", false, []string{"1234/2024/notes.txt", "1234/2024/scan.PDF"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := defaultLoadOptions()
+			options.FollowSymlinks = tt.followSymlinks
+			files, err := walkDocuments(root, options)
+			if err != nil {
+				t.Fatalf("walkDocuments() error = %v", err)
+			}
+			var got []string
+			for _, file := range files {
+				got = append(got, file.RelPath)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("walkDocuments() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}